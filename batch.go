@@ -0,0 +1,86 @@
+package sal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Batch is the value of named arg that is expanded to the list of rows by ProcessQuery,
+// the field of request is marked with the option batch of tag, `sql:"rows,batch"`.
+//
+//	INSERT INTO books (id, title) VALUES @rows -> INSERT INTO books (id, title) VALUES ($1, $2), ($3, $4)
+//
+// The values of each row are in order of Cols, the column names are used as the names of args.
+// The empty batch can't be rendered to the valid query, so the generated methods don't query
+// the database if the batch is empty, the methods that return the single row fail with ErrEmptyBatch.
+type Batch struct {
+	Cols []string
+	Rows [][]interface{}
+}
+
+// ErrEmptyBatch is returned by the generated methods that return the single row if the batch
+// of request is empty.
+var ErrEmptyBatch = errors.New("sal: empty batch")
+
+// BatchSizeError is returned by the generated methods if the batch can't be bound to the query.
+// The batch of method that returns the single row isn't split to chunks, so it can't have
+// more rows than Max. Max is zero if even the single row doesn't fit into the limit of args.
+type BatchSizeError struct {
+	Name string
+	Rows int
+	Max  int
+}
+
+func (e *BatchSizeError) Error() string {
+	if e.Max == 0 {
+		return fmt.Sprintf("sal: row of batch %s exceeds the limit of args of query", e.Name)
+	}
+	return fmt.Sprintf("sal: batch %s of %d rows exceeds the limit of %d rows of query", e.Name, e.Rows, e.Max)
+}
+
+// BatchSize returns the maximum number of rows of the batch arg name with cols values per row
+// that can be bound to the query with the rest of args, so the number of args stays under
+// the limit of database, e.g. 65535 for PostgreSQL. It returns zero if even the single row
+// doesn't fit into the limit with the rest of args.
+func (ctrl *Controller) BatchSize(query string, name string, cols int) int {
+	other := 0
+	for _, n := range ctrl.processQuery(query).names {
+		if n != name {
+			other++
+		}
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	if other >= maxArgs(ctrl.dialect()) {
+		return 0
+	}
+	return (maxArgs(ctrl.dialect()) - other) / cols
+}
+
+// BatchResult is the result of Exec method with the batch that is executed by chunks.
+// RowsAffected returns the sum of affected rows, LastInsertId returns the id of the last chunk.
+type BatchResult []sql.Result
+
+// LastInsertId returns the id of the last chunk.
+func (br BatchResult) LastInsertId() (int64, error) {
+	if len(br) == 0 {
+		return 0, nil
+	}
+	return br[len(br)-1].LastInsertId()
+}
+
+// RowsAffected returns the sum of affected rows of chunks.
+func (br BatchResult) RowsAffected() (int64, error) {
+	var total int64
+	for _, res := range br {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
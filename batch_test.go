@@ -0,0 +1,97 @@
+package sal
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController_ProcessQuery_Batch(t *testing.T) {
+	var (
+		shelfID = int64(7)
+		batch   = Batch{
+			Cols: []string{"id", "title"},
+			Rows: [][]interface{}{{int64(1), "foo"}, {int64(2), "bar"}},
+		}
+		reqMap = make(RowMap)
+	)
+	reqMap.AppendTo("shelf_id", &shelfID)
+	reqMap.AppendTo("rows", batch)
+	query := `INSERT INTO books (shelf_id, id, title) SELECT @shelf_id, * FROM (VALUES @rows) v WHERE @shelf_id > 0`
+
+	for _, tc := range []struct {
+		name  string
+		ctrl  *Controller
+		query string
+		names []string
+		args  []interface{}
+	}{
+		{
+			name:  "postgres",
+			ctrl:  NewController(),
+			query: `INSERT INTO books (shelf_id, id, title) SELECT $1, * FROM (VALUES ($2, $3), ($4, $5)) v WHERE $1 > 0`,
+			names: []string{"shelf_id", "id", "title", "id", "title"},
+			args:  []interface{}{&shelfID, int64(1), "foo", int64(2), "bar"},
+		},
+		{
+			name:  "mysql",
+			ctrl:  NewController(WithDialect(DialectMySQL)),
+			query: `INSERT INTO books (shelf_id, id, title) SELECT ?, * FROM (VALUES (?, ?), (?, ?)) v WHERE ? > 0`,
+			names: []string{"shelf_id", "id", "title", "id", "title", "shelf_id"},
+			args:  []interface{}{&shelfID, int64(1), "foo", int64(2), "bar", &shelfID},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actQuery, actNames, actArgs := tc.ctrl.ProcessQuery(query, reqMap)
+			assert.Equal(t, tc.query, actQuery)
+			assert.Equal(t, tc.names, actNames)
+			assert.Equal(t, tc.args, actArgs)
+
+			// the batch doesn't affect the cached query without batch.
+			plainQuery, _, plainArgs := tc.ctrl.ProcessQuery(query, RowMap{"shelf_id": {&shelfID}})
+			assert.NotEqual(t, tc.query, plainQuery)
+			assert.Equal(t, &shelfID, plainArgs[0])
+		})
+	}
+}
+
+func TestController_BatchSize(t *testing.T) {
+	query := `INSERT INTO books (shelf_id, id, title) SELECT @shelf_id, * FROM (VALUES @rows) v`
+	assert.Equal(t, (65535-1)/2, NewController().BatchSize(query, "rows", 2))
+	assert.Equal(t, (999-1)/2, NewController(WithDialect(DialectSQLite)).BatchSize(query, "rows", 2))
+	// even the single row doesn't fit into the limit.
+	assert.Equal(t, 0, NewController(WithDialect(DialectSQLite)).BatchSize(query, "rows", 5000))
+	// the rest of args reach the limit.
+	args := make([]string, 999)
+	for i := range args {
+		args[i] = "@a" + strconv.Itoa(i)
+	}
+	withArgs := func(args []string) string {
+		return `INSERT INTO books SELECT ` + strings.Join(args, ", ") + ` FROM (VALUES @rows) v`
+	}
+	assert.Equal(t, 0, NewController(WithDialect(DialectSQLite)).BatchSize(withArgs(args), "rows", 1))
+	assert.Equal(t, 1, NewController(WithDialect(DialectSQLite)).BatchSize(withArgs(args[1:]), "rows", 1))
+}
+
+func TestBatchSizeError(t *testing.T) {
+	assert.EqualError(t, &BatchSizeError{Name: "rows", Rows: 10, Max: 5}, "sal: batch rows of 10 rows exceeds the limit of 5 rows of query")
+	assert.EqualError(t, &BatchSizeError{Name: "rows", Rows: 10}, "sal: row of batch rows exceeds the limit of args of query")
+}
+
+func TestBatchResult(t *testing.T) {
+	res := BatchResult{sqlmock.NewResult(3, 2), sqlmock.NewResult(5, 1)}
+	n, err := res.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	id, err := res.LastInsertId()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), id)
+
+	n, err = BatchResult{}.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
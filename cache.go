@@ -0,0 +1,294 @@
+package sal
+
+import (
+	"container/list"
+	"database/sql"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// lruCache is a cache of limited size. When the cache is full the least recently used entry
+// is evicted. It's safe for concurrent use.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+// newLRUCache returns the cache that holds at most size entries.
+// If size is zero or negative the cache doesn't keep anything, as well as the nil cache.
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value by key and marks it as recently used.
+func (c *lruCache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+// Add puts the value to the cache if the key isn't presented yet and returns the value
+// that is kept in the cache by the key and the evicted values.
+func (c *lruCache) Add(key string, value interface{}) (interface{}, []interface{}) {
+	if c == nil || c.size <= 0 {
+		return value, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*lruEntry).value, nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	var evicted []interface{}
+	for c.ll.Len() > c.size {
+		entry := c.ll.Remove(c.ll.Back()).(*lruEntry)
+		delete(c.items, entry.key)
+		evicted = append(evicted, entry.value)
+	}
+	return value, evicted
+}
+
+// Purge removes all entries from the cache and returns them.
+func (c *lruCache) Purge() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]interface{}, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		values = append(values, el.Value.(*lruEntry).value)
+	}
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	return values
+}
+
+// Len returns the number of entries in the cache.
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// DefaultStmtCacheSize is the default number of prepared statements cached by the Controller.
+const DefaultStmtCacheSize = 1000
+
+// StmtCache is a cache of prepared statements limited by size.
+// When the cache is full the least recently used statement is evicted and closed.
+//
+// The Controller acquires the statement for the time of its use, so the statement that is evicted
+// while it's used by another goroutine is closed when the last user releases it.
+type StmtCache struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	lru       *lruCache
+	// mu guards the references to statements, see stmtEntry.
+	mu sync.Mutex
+}
+
+// stmtEntry is the cached statement with the number of its users.
+// The evicted statement is closed when refs is zero.
+type stmtEntry struct {
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// StmtCacheStats contains the statistics of the usage of StmtCache.
+type StmtCacheStats struct {
+	// Size is the number of statements in the cache.
+	Size int
+	// Hits is the number of lookups that found the statement.
+	Hits uint64
+	// Misses is the number of lookups that didn't find the statement.
+	Misses uint64
+	// Evictions is the number of statements that were evicted and closed.
+	Evictions uint64
+}
+
+// NewStmtCache returns the cache that holds at most size statements.
+// If size is zero or negative the cache is unbounded.
+func NewStmtCache(size int) *StmtCache {
+	if size <= 0 {
+		size = math.MaxInt32
+	}
+	return &StmtCache{lru: newLRUCache(size)}
+}
+
+// Get returns the statement prepared for the query or nil if it isn't presented in the cache.
+// The statement isn't acquired, so it can be closed on eviction at any moment, see Controller.Stmt.
+func (c *StmtCache) Get(query string) *sql.Stmt {
+	stmt, release := c.acquire(query)
+	if stmt != nil {
+		release()
+	}
+	return stmt
+}
+
+// Put puts the statement to the cache and returns the statement to use for the query.
+// If the statement for the query is already cached then the cached one is returned
+// and the passed statement is closed.
+func (c *StmtCache) Put(query string, stmt *sql.Stmt) *sql.Stmt {
+	stmt, release := c.putAcquire(query, stmt)
+	release()
+	return stmt
+}
+
+// acquire is like Get but the returned statement isn't closed until release is called.
+func (c *StmtCache) acquire(query string) (*sql.Stmt, func()) {
+	c.mu.Lock()
+	v, ok := c.lru.Get(query)
+	if !ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, nil
+	}
+	entry := v.(*stmtEntry)
+	entry.refs++
+	c.mu.Unlock()
+	atomic.AddUint64(&c.hits, 1)
+	return entry.stmt, c.releaseFunc(entry)
+}
+
+// putAcquire is like Put but the returned statement isn't closed until release is called.
+func (c *StmtCache) putAcquire(query string, stmt *sql.Stmt) (*sql.Stmt, func()) {
+	c.mu.Lock()
+	v, evicted := c.lru.Add(query, &stmtEntry{stmt: stmt})
+	entry := v.(*stmtEntry)
+	entry.refs++
+	closing := c.evict(evicted)
+	c.mu.Unlock()
+
+	if entry.stmt != stmt {
+		stmt.Close()
+	}
+	atomic.AddUint64(&c.evictions, uint64(len(evicted)))
+	for _, stmt := range closing {
+		stmt.Close()
+	}
+	return entry.stmt, c.releaseFunc(entry)
+}
+
+// evict marks the entries as evicted and returns the statements that aren't used and can be closed.
+// It's called with locked mu.
+func (c *StmtCache) evict(entries []interface{}) []*sql.Stmt {
+	var closing []*sql.Stmt
+	for _, v := range entries {
+		entry := v.(*stmtEntry)
+		entry.evicted = true
+		if entry.refs == 0 {
+			closing = append(closing, entry.stmt)
+		}
+	}
+	return closing
+}
+
+// releaseFunc returns the func that releases the acquired entry and closes the statement
+// if it's evicted and it's not used anymore. The func can be called more than once.
+func (c *StmtCache) releaseFunc(entry *stmtEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			entry.refs--
+			closing := entry.evicted && entry.refs == 0
+			c.mu.Unlock()
+			if closing {
+				entry.stmt.Close()
+			}
+		})
+	}
+}
+
+// Len returns the number of statements in the cache.
+func (c *StmtCache) Len() int {
+	return c.lru.Len()
+}
+
+// Stats returns the statistics of the cache.
+func (c *StmtCache) Stats() StmtCacheStats {
+	return StmtCacheStats{
+		Size:      c.Len(),
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// Close removes all statements from the cache and closes them, the statements that are used
+// are closed when they are released. Returns the first error of closing.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	closing := c.evict(c.lru.Purge())
+	c.mu.Unlock()
+
+	var err error
+	for _, stmt := range closing {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// handlerCache returns the cache of statements prepared on the shard or the replica key,
+// the statements are bound to the connections of handler, so each handler has its own cache.
+// The caches have the size of Controller.CacheStmts and are closed by Controller.Close.
+func (ctrl *Controller) handlerCache(key interface{}) *StmtCache {
+	if !reflect.TypeOf(key).Comparable() {
+		return ctrl.CacheStmts
+	}
+	ctrl.Lock()
+	defer ctrl.Unlock()
+	if ctrl.handlerStmts == nil {
+		ctrl.handlerStmts = make(map[interface{}]*StmtCache)
+	}
+	cache, ok := ctrl.handlerStmts[key]
+	if !ok {
+		cache = NewStmtCache(ctrl.stmtCacheSize)
+		ctrl.handlerStmts[key] = cache
+	}
+	return cache
+}
+
+// StmtCacheStats returns the total statistics of caches of prepared statements of controller,
+// including the caches of shards and replicas.
+func (ctrl *Controller) StmtCacheStats() StmtCacheStats {
+	var total StmtCacheStats
+	add := func(s StmtCacheStats) {
+		total.Size += s.Size
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+		total.Evictions += s.Evictions
+	}
+	if ctrl.CacheStmts != nil {
+		add(ctrl.CacheStmts.Stats())
+	}
+	ctrl.RLock()
+	defer ctrl.RUnlock()
+	for _, cache := range ctrl.handlerStmts {
+		add(cache.Stats())
+	}
+	return total
+}
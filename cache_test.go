@@ -0,0 +1,207 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestLRUCache(t *testing.T) {
+	assert := assert.New(t)
+	c := newLRUCache(2)
+	v, evicted := c.Add("a", 1)
+	assert.Equal(1, v)
+	assert.Nil(evicted)
+	c.Add("b", 2)
+
+	// "a" becomes recently used, so "b" is evicted
+	v, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal(1, v)
+	_, evicted = c.Add("c", 3)
+	assert.Equal([]interface{}{2}, evicted)
+	_, ok = c.Get("b")
+	assert.False(ok)
+	assert.Equal(2, c.Len())
+
+	// the value that is already presented is kept
+	v, evicted = c.Add("a", 11)
+	assert.Equal(1, v)
+	assert.Nil(evicted)
+
+	assert.ElementsMatch([]interface{}{1, 3}, c.Purge())
+	assert.Equal(0, c.Len())
+}
+
+func TestLRUCache_Zero(t *testing.T) {
+	c := newLRUCache(0)
+	v, evicted := c.Add("a", 1)
+	assert.Equal(t, 1, v)
+	assert.Nil(t, evicted)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestStmtCache(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	prepare := func(query string) *sql.Stmt {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			t.Fatalf("failed to prepare stmt: %s", err)
+		}
+		return stmt
+	}
+
+	mock.ExpectPrepare("SELECT 1").WillBeClosed()
+	mock.ExpectPrepare("SELECT 2").WillBeClosed()
+	mock.ExpectPrepare("SELECT 2").WillBeClosed()
+	mock.ExpectPrepare("SELECT 3").WillBeClosed()
+
+	c := NewStmtCache(2)
+	assert.Nil(c.Get("SELECT 1"))
+	stmt1 := prepare("SELECT 1")
+	assert.Equal(stmt1, c.Put("SELECT 1", stmt1))
+	stmt2 := prepare("SELECT 2")
+	assert.Equal(stmt2, c.Put("SELECT 2", stmt2))
+
+	// concurrently prepared stmt is closed and the cached one is returned
+	assert.Equal(stmt2, c.Put("SELECT 2", prepare("SELECT 2")))
+
+	// the least recently used stmt is evicted
+	assert.Equal(stmt2, c.Get("SELECT 2"))
+	c.Put("SELECT 3", prepare("SELECT 3"))
+	assert.Nil(c.Get("SELECT 1"))
+
+	assert.Equal(StmtCacheStats{Size: 2, Hits: 1, Misses: 2, Evictions: 1}, c.Stats())
+
+	assert.NoError(c.Close())
+	assert.Equal(0, c.Len())
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+func TestStmtCache_AcquireEvicted(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectPrepare("SELECT 1")
+	mock.ExpectPrepare("SELECT 2")
+	c := NewStmtCache(1)
+	stmt1, _ := db.Prepare("SELECT 1")
+	c.Put("SELECT 1", stmt1)
+	stmt, release := c.acquire("SELECT 1")
+	assert.Equal(stmt1, stmt)
+
+	// the acquired stmt is evicted but it isn't closed until it's released.
+	stmt2, _ := db.Prepare("SELECT 2")
+	c.Put("SELECT 2", stmt2)
+	assert.Nil(c.Get("SELECT 1"))
+	mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = stmt.Exec()
+	assert.NoError(err)
+
+	release()
+	release()
+	_, err = stmt.Exec()
+	assert.Error(err)
+	assert.Equal(uint64(1), c.Stats().Evictions)
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+// countDriver is the driver that executes any query and counts the open statements.
+type countDriver struct {
+	stmts int64
+}
+
+func (d *countDriver) Open(name string) (driver.Conn, error) { return countConn{d}, nil }
+
+type countConn struct{ d *countDriver }
+
+func (c countConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt64(&c.d.stmts, 1)
+	return countStmt{c.d}, nil
+}
+func (c countConn) Close() error              { return nil }
+func (c countConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type countStmt struct{ d *countDriver }
+
+func (s countStmt) Close() error {
+	atomic.AddInt64(&s.d.stmts, -1)
+	return nil
+}
+func (s countStmt) NumInput() int { return -1 }
+func (s countStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s countStmt) Query(args []driver.Value) (driver.Rows, error) { return countRows{}, nil }
+
+type countRows struct{}
+
+func (countRows) Columns() []string              { return []string{"n"} }
+func (countRows) Close() error                   { return nil }
+func (countRows) Next(dest []driver.Value) error { return io.EOF }
+
+var countDriverSeq int64
+
+func TestController_StmtConcurrentEviction(t *testing.T) {
+	d := &countDriver{}
+	name := "sal_count_" + strconv.FormatInt(atomic.AddInt64(&countDriverSeq, 1), 10)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+
+	// the cache of one statement evicts the statements all the time.
+	ctrl := NewController(StmtCacheSize(1))
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				query := "SELECT " + strconv.Itoa((g+i)%3)
+				stmt, err := ctrl.Stmt(ctx, nil, db, query)
+				if !assert.NoError(t, err) {
+					return
+				}
+				if i%2 == 0 {
+					_, err = stmt.ExecContext(ctx)
+					assert.NoError(t, err, query)
+					continue
+				}
+				rows, err := stmt.QueryContext(ctx)
+				if assert.NoError(t, err, query) {
+					rows.Close()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.NoError(t, ctrl.Close())
+	assert.NoError(t, db.Close())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&d.stmts))
+}
@@ -0,0 +1,158 @@
+package sal
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TableNamer is an interface of the item of request of copy method that returns the name of table
+// to insert the rows to.
+//
+//	func (b *Book) TableName() string { return "books" }
+type TableNamer interface {
+	TableName() string
+}
+
+// DefaultCopyBatchSize is the maximum number of rows inserted by one statement
+// if COPY isn't supported. The size is reduced to fit the limit of args of the database.
+const DefaultCopyBatchSize = 1000
+
+// maxArgs returns the maximum number of args of the statement supported by the database of dialect.
+func maxArgs(d Dialect) int {
+	switch d.Name() {
+	case DialectSQLServer.Name():
+		return 2100 - 1
+	case DialectSQLite.Name():
+		return 999
+	}
+	return 65535
+}
+
+// SkipCopy disables COPY FROM for copy methods, the rows are inserted by batches
+// with multi-row INSERT statements. It's required for drivers of PostgreSQL
+// that don't support COPY through database/sql.
+func SkipCopy() ClientOption {
+	return func(ctrl *Controller) { ctrl.SkipCopy = true }
+}
+
+// useCopy reports whether the rows are inserted with COPY FROM.
+func (ctrl *Controller) useCopy() bool {
+	return !ctrl.SkipCopy && ctrl.dialect().Name() == DialectPostgreSQL.Name()
+}
+
+// CopyQuery returns the statement that is used by CopyFrom, it's passed to the hooks of copy methods.
+// If COPY isn't used then it's the INSERT statement of the single row.
+func (ctrl *Controller) CopyQuery(table string, cols []string) string {
+	if ctrl.useCopy() {
+		return "COPY " + ctrl.quoteTable(table) + " (" + ctrl.quoteCols(cols) + ") FROM STDIN"
+	}
+	return ctrl.insertQuery(table, cols, 1)
+}
+
+// CopyFrom inserts the rows to the table, the values of rows are in order of cols.
+// For PostgreSQL the rows are sent with COPY FROM STDIN, the statement is prepared on qh, so qh should
+// be the transaction. Otherwise the rows are inserted by batches with multi-row INSERT statements.
+// It returns the number of inserted rows. The error is returned if cols is empty.
+func (ctrl *Controller) CopyFrom(ctx context.Context, qh QueryHandler, table string, cols []string, rows [][]interface{}) (int64, error) {
+	if len(cols) == 0 {
+		return 0, errors.Errorf("failed to copy rows to %s: no columns", table)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if ctrl.useCopy() {
+		return ctrl.copyIn(ctx, qh, table, cols, rows)
+	}
+	return ctrl.insertBatches(ctx, qh, table, cols, rows)
+}
+
+func (ctrl *Controller) copyIn(ctx context.Context, qh QueryHandler, table string, cols []string, rows [][]interface{}) (int64, error) {
+	stmt, err := qh.PrepareContext(ctx, ctrl.CopyQuery(table, cols))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to prepare copy")
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err = stmt.ExecContext(ctx, row...); err != nil {
+			return 0, errors.Wrap(err, "failed to copy row")
+		}
+	}
+	// the call without args flushes the buffered rows.
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to complete copy")
+	}
+	return int64(len(rows)), nil
+}
+
+func (ctrl *Controller) insertBatches(ctx context.Context, qh QueryHandler, table string, cols []string, rows [][]interface{}) (int64, error) {
+	size := DefaultCopyBatchSize
+	if limit := maxArgs(ctrl.dialect()) / len(cols); limit < size {
+		size = limit
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	var total int64
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		args := make([]interface{}, 0, (end-start)*len(cols))
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+		res, err := qh.ExecContext(ctx, ctrl.insertQuery(table, cols, end-start), args...)
+		if err != nil {
+			return total, errors.Wrap(err, "failed to insert rows")
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			affected = int64(end - start)
+		}
+		total += affected
+	}
+	return total, nil
+}
+
+// insertQuery returns the INSERT statement of n rows.
+func (ctrl *Controller) insertQuery(table string, cols []string, n int) string {
+	d := ctrl.dialect()
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + ctrl.quoteTable(table) + " (" + ctrl.quoteCols(cols) + ") VALUES ")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range cols {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(d.Placeholder(i*len(cols) + j + 1))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// quoteTable quotes the name of table, the name can be qualified with the schema, "public.books".
+func (ctrl *Controller) quoteTable(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = ctrl.dialect().QuoteIdent(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (ctrl *Controller) quoteCols(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = ctrl.dialect().QuoteIdent(col)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,50 @@
+package sal
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController_CopyQuery(t *testing.T) {
+	cols := []string{"id", "title"}
+	assert.Equal(t, `COPY "public"."books" ("id", "title") FROM STDIN`, NewController().CopyQuery("public.books", cols))
+	assert.Equal(t, `INSERT INTO "books" ("id", "title") VALUES ($1, $2)`, NewController(SkipCopy()).CopyQuery("books", cols))
+	assert.Equal(t, "INSERT INTO `books` (`id`, `title`) VALUES (?, ?)", NewController(WithDialect(DialectMySQL)).CopyQuery("books", cols))
+}
+
+func TestController_CopyFrom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// the batch is limited by the number of args of SQLite, so each row is inserted separately.
+	cols := make([]string, 500)
+	row := make([]interface{}, 500)
+	for i := range cols {
+		cols[i] = "c" + strconv.Itoa(i)
+		row[i] = int64(i)
+	}
+	ctrl := NewController(WithDialect(DialectSQLite))
+	mock.ExpectExec(`INSERT INTO "t" \("c0", .+\) VALUES \(\?, .+\?\)$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "t" \("c0", .+\) VALUES \(\?, .+\?\)$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	n, err := ctrl.CopyFrom(context.Background(), db, "t", cols, [][]interface{}{row, row})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = ctrl.CopyFrom(context.Background(), db, "t", cols, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// the rows without columns can't be inserted.
+	_, err = ctrl.CopyFrom(context.Background(), db, "t", nil, [][]interface{}{{}})
+	assert.EqualError(t, err, "failed to copy rows to t: no columns")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
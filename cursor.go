@@ -0,0 +1,73 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFetchSize is the default number of rows fetched from the cursor at once.
+const DefaultFetchSize = 1000
+
+// FetchSizer is an interface of request of cursor method that defines the number of rows
+// fetched from the cursor at once and passed to the callback.
+//
+//	func (r *ExportAuthorsReq) FetchSize() int { return 10000 }
+type FetchSizer interface {
+	FetchSize() int
+}
+
+// FetchSizeOf returns the fetch size of request that implements FetchSizer or DefaultFetchSize.
+func FetchSizeOf(req interface{}) int {
+	if fs, ok := req.(FetchSizer); ok && fs.FetchSize() > 0 {
+		return fs.FetchSize()
+	}
+	return DefaultFetchSize
+}
+
+// cursorSeq is used to give the unique names to cursors.
+var cursorSeq uint64
+
+// Cursor is the server-side cursor of PostgreSQL that reads the result of query by batches.
+// The cursor exists only in the transaction, so qh should be the transaction.
+type Cursor struct {
+	qh   QueryHandler
+	name string
+}
+
+// DeclareCursor declares the cursor for the query on the transaction qh.
+func DeclareCursor(ctx context.Context, qh QueryHandler, query string, args ...interface{}) (*Cursor, error) {
+	cur := &Cursor{
+		qh:   qh,
+		name: "sal_cur_" + strconv.FormatUint(atomic.AddUint64(&cursorSeq, 1), 10),
+	}
+	if _, err := qh.ExecContext(ctx, "DECLARE "+cur.name+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to declare cursor")
+	}
+	return cur, nil
+}
+
+// Name returns the name of cursor.
+func (cur *Cursor) Name() string {
+	return cur.name
+}
+
+// Fetch fetches the next n rows of the cursor. The returned rows are empty if the cursor is exhausted.
+func (cur *Cursor) Fetch(ctx context.Context, n int) (*sql.Rows, error) {
+	rows, err := cur.qh.QueryContext(ctx, "FETCH FORWARD "+strconv.Itoa(n)+" FROM "+cur.name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch cursor")
+	}
+	return rows, nil
+}
+
+// Close closes the cursor.
+func (cur *Cursor) Close(ctx context.Context) error {
+	if _, err := cur.qh.ExecContext(ctx, "CLOSE "+cur.name); err != nil {
+		return errors.Wrap(err, "failed to close cursor")
+	}
+	return nil
+}
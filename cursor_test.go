@@ -0,0 +1,76 @@
+package sal
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fetchSizeReq int
+
+func (r fetchSizeReq) FetchSize() int { return int(r) }
+
+func TestFetchSizeOf(t *testing.T) {
+	assert.Equal(t, 50, FetchSizeOf(fetchSizeReq(50)))
+	assert.Equal(t, DefaultFetchSize, FetchSizeOf(fetchSizeReq(0)))
+	assert.Equal(t, DefaultFetchSize, FetchSizeOf(struct{}{}))
+}
+
+func TestCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+
+	mock.ExpectExec(`^DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT \* FROM authors WHERE id>\$1$`).
+		WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 0))
+	cur, err := DeclareCursor(ctx, tx, "SELECT * FROM authors WHERE id>$1", 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Regexp(t, `^sal_cur_[0-9]+$`, cur.Name())
+
+	mock.ExpectQuery(`^FETCH FORWARD 2 FROM ` + cur.Name() + `$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11).AddRow(12))
+	rows, err := cur.Fetch(ctx, 2)
+	if assert.NoError(t, err) {
+		var ids []int
+		for rows.Next() {
+			var id int
+			assert.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		assert.Equal(t, []int{11, 12}, ids)
+		rows.Close()
+	}
+
+	mock.ExpectExec(`^CLOSE ` + cur.Name() + `$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, cur.Close(ctx))
+
+	// the errors of database are wrapped.
+	errDB := errors.New("cursor doesn't exist")
+	mock.ExpectQuery(`^FETCH FORWARD 1 FROM ` + cur.Name() + `$`).WillReturnError(errDB)
+	_, err = cur.Fetch(ctx, 1)
+	assert.Equal(t, errDB, errors.Cause(err))
+	assert.Contains(t, err.Error(), "failed to fetch cursor")
+	mock.ExpectExec(`^CLOSE ` + cur.Name() + `$`).WillReturnError(errDB)
+	err = cur.Close(ctx)
+	assert.Equal(t, errDB, errors.Cause(err))
+	assert.Contains(t, err.Error(), "failed to close cursor")
+	mock.ExpectExec(`^DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT 1$`).WillReturnError(errDB)
+	_, err = DeclareCursor(ctx, tx, "SELECT 1")
+	assert.Equal(t, errDB, errors.Cause(err))
+	assert.Contains(t, err.Error(), "failed to declare cursor")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,95 @@
+package sal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the specifics of SQL syntax of the database
+// that are required to build the query.
+type Dialect interface {
+	// Name returns the short name of dialect, e.g. "postgres".
+	Name() string
+	// Placeholder returns the placeholder for the arg on position n, starting with 1.
+	Placeholder(n int) string
+	// Numbered reports whether the placeholder refers to the arg by its position.
+	// If so, the repeated named arg reuses the placeholder,
+	// otherwise the value is bound for each occurrence of named arg.
+	Numbered() bool
+	// QuoteIdent quotes the identifier, e.g. the name of table or column.
+	QuoteIdent(name string) string
+}
+
+var (
+	// DialectPostgreSQL uses placeholders $1, $2 and quotes identifiers with double quotes.
+	DialectPostgreSQL Dialect = numberedDialect{name: "postgres", prefix: "$", quote: `"`}
+	// DialectMySQL uses placeholders ? and quotes identifiers with backticks.
+	DialectMySQL Dialect = questionDialect{name: "mysql", quote: "`"}
+	// DialectSQLite uses placeholders ? and quotes identifiers with double quotes.
+	DialectSQLite Dialect = questionDialect{name: "sqlite", quote: `"`}
+	// DialectSQLServer uses placeholders @p1, @p2 and quotes identifiers with square brackets.
+	DialectSQLServer Dialect = numberedDialect{name: "sqlserver", prefix: "@p", quote: "[]"}
+	// DialectOracle uses placeholders :1, :2 and quotes identifiers with double quotes.
+	DialectOracle Dialect = numberedDialect{name: "oracle", prefix: ":", quote: `"`}
+)
+
+// numberedDialect is a dialect with placeholders that refer to the arg by position.
+type numberedDialect struct {
+	name   string
+	prefix string
+	quote  string
+}
+
+func (d numberedDialect) Name() string {
+	return d.name
+}
+
+func (d numberedDialect) Placeholder(n int) string {
+	return d.prefix + strconv.Itoa(n)
+}
+
+func (d numberedDialect) Numbered() bool {
+	return true
+}
+
+func (d numberedDialect) QuoteIdent(name string) string {
+	return quoteIdent(name, d.quote)
+}
+
+// questionDialect is a dialect with anonymous placeholders ?.
+type questionDialect struct {
+	name  string
+	quote string
+}
+
+func (d questionDialect) Name() string {
+	return d.name
+}
+
+func (d questionDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d questionDialect) Numbered() bool {
+	return false
+}
+
+func (d questionDialect) QuoteIdent(name string) string {
+	return quoteIdent(name, d.quote)
+}
+
+// dialect returns the Dialect of controller, DialectPostgreSQL is used if it isn't set.
+func (ctrl *Controller) dialect() Dialect {
+	if ctrl.Dialect == nil {
+		return DialectPostgreSQL
+	}
+	return ctrl.Dialect
+}
+
+// quoteIdent wraps the name with quotes. If quote contains two symbols then
+// the first is used as the opening quote and the second as the closing one.
+// The closing quote inside the name is escaped by doubling.
+func quoteIdent(name string, quote string) string {
+	open, closing := quote[:1], quote[len(quote)-1:]
+	return open + strings.Replace(name, closing, closing+closing, -1) + closing
+}
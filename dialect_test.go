@@ -0,0 +1,128 @@
+package sal
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect(t *testing.T) {
+	const query = "SELECT * FROM authors WHERE a=@id OR b=@id AND c=@name AND d='@skip'"
+	for _, tc := range []struct {
+		dialect Dialect
+		name    string
+		query   string
+		args    []string
+		ident   string
+	}{
+		{
+			dialect: DialectPostgreSQL,
+			name:    "postgres",
+			query:   "SELECT * FROM authors WHERE a=$1 OR b=$1 AND c=$2 AND d='@skip'",
+			args:    []string{"id", "name"},
+			ident:   `"na""me"`,
+		}, {
+			dialect: DialectMySQL,
+			name:    "mysql",
+			query:   "SELECT * FROM authors WHERE a=? OR b=? AND c=? AND d='@skip'",
+			args:    []string{"id", "id", "name"},
+			ident:   "`na\"me`",
+		}, {
+			dialect: DialectSQLite,
+			name:    "sqlite",
+			query:   "SELECT * FROM authors WHERE a=? OR b=? AND c=? AND d='@skip'",
+			args:    []string{"id", "id", "name"},
+			ident:   `"na""me"`,
+		}, {
+			dialect: DialectSQLServer,
+			name:    "sqlserver",
+			query:   "SELECT * FROM authors WHERE a=@p1 OR b=@p1 AND c=@p2 AND d='@skip'",
+			args:    []string{"id", "name"},
+			ident:   `[na"me]`,
+		}, {
+			dialect: DialectOracle,
+			name:    "oracle",
+			query:   "SELECT * FROM authors WHERE a=:1 OR b=:1 AND c=:2 AND d='@skip'",
+			args:    []string{"id", "name"},
+			ident:   `"na""me"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(tc.name, tc.dialect.Name())
+			q, args := parseQuery(query, tc.dialect).render(tc.dialect)
+			assert.Equal(tc.query, q)
+			assert.Equal(tc.args, args)
+			assert.Equal(tc.ident, tc.dialect.QuoteIdent(`na"me`))
+		})
+	}
+	assert.Equal(t, "[a]]b]", DialectSQLServer.QuoteIdent("a]b"))
+	assert.Equal(t, "`a``b`", DialectMySQL.QuoteIdent("a`b"))
+}
+
+func TestController_NilDialect(t *testing.T) {
+	for name, ctrl := range map[string]*Controller{
+		"zero value": {},
+		"with nil":   NewController(WithDialect(nil)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			reqMap := RowMap{"id": {1}, "rows": {Batch{Cols: []string{"a"}, Rows: [][]interface{}{{2}, {3}}}}}
+			query, args := ctrl.ProcessQueryAndArgs("SELECT @id; INSERT INTO t (a) VALUES @rows", reqMap)
+			assert.Equal(t, "SELECT $1; INSERT INTO t (a) VALUES ($2), ($3)", query)
+			assert.Equal(t, []interface{}{1, 2, 3}, args)
+			query, args = ctrl.ProcessQueryAndArgs("SELECT @id", reqMap)
+			assert.Equal(t, "SELECT $1", query)
+			assert.Equal(t, []interface{}{1}, args)
+		})
+	}
+}
+
+func TestController_ProcessQuery_Lists(t *testing.T) {
+	const query = "SELECT * FROM authors WHERE id IN (@ids) AND name=@name AND data=@data AND tags=@tags"
+	var (
+		ids    = []int64{1, 2, 3}
+		name   = "foo"
+		data   = []byte("bar")
+		tags   = pq.Array([]string{"a"})
+		reqMap = RowMap{"ids": {&ids}, "name": {&name}, "data": {&data}, "tags": {tags}}
+	)
+
+	q, names, args := NewController(WithDialect(DialectMySQL)).ProcessQuery(query, reqMap)
+	assert.Equal(t, "SELECT * FROM authors WHERE id IN (?, ?, ?) AND name=? AND data=? AND tags=?", q)
+	assert.Equal(t, []string{"ids", "ids", "ids", "name", "data", "tags"}, names)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), &name, &data, tags}, args)
+
+	q, _, args = NewController(WithDialect(DialectSQLServer)).ProcessQuery(query, reqMap)
+	assert.Equal(t, "SELECT * FROM authors WHERE id IN (@p1, @p2, @p3) AND name=@p4 AND data=@p5 AND tags=@p6", q)
+	assert.Len(t, args, 6)
+
+	// the empty slice is the subquery without rows, so IN matches no rows and NOT IN matches all rows.
+	var empty []int64
+	reqMap["ids"] = []interface{}{&empty}
+	q, names, args = NewController(WithDialect(DialectSQLite)).ProcessQuery(query, reqMap)
+	assert.Equal(t, "SELECT * FROM authors WHERE id IN (SELECT NULL WHERE 1=0) AND name=? AND data=? AND tags=?", q)
+	assert.Equal(t, []string{"name", "data", "tags"}, names)
+	assert.Len(t, args, 3)
+	for _, tc := range []struct {
+		dialect Dialect
+		query   string
+		exp     string
+	}{
+		{DialectSQLite, "SELECT * FROM t WHERE id NOT IN (@ids)", "SELECT * FROM t WHERE id NOT IN (SELECT NULL WHERE 1=0)"},
+		{DialectSQLServer, "SELECT * FROM t WHERE id NOT IN (@ids)", "SELECT * FROM t WHERE id NOT IN (SELECT NULL WHERE 1=0)"},
+		{DialectMySQL, "SELECT * FROM t WHERE id IN (@ids)", "SELECT * FROM t WHERE id IN (SELECT NULL FROM DUAL WHERE 1=0)"},
+		{DialectMySQL, "SELECT * FROM t WHERE id NOT IN (@ids)", "SELECT * FROM t WHERE id NOT IN (SELECT NULL FROM DUAL WHERE 1=0)"},
+		{DialectOracle, "SELECT * FROM t WHERE id NOT IN (@ids)", "SELECT * FROM t WHERE id NOT IN (SELECT NULL FROM DUAL WHERE 1=0)"},
+	} {
+		q, names, args = NewController(WithDialect(tc.dialect)).ProcessQuery(tc.query, reqMap)
+		assert.Equal(t, tc.exp, q, tc.dialect.Name())
+		assert.Empty(t, names)
+		assert.Empty(t, args)
+	}
+
+	// PostgreSQL binds the slice as is, it's used with ANY(@ids).
+	q, _, args = NewController().ProcessQuery(query, reqMap)
+	assert.Equal(t, "SELECT * FROM authors WHERE id IN ($1) AND name=$2 AND data=$3 AND tags=$4", q)
+	assert.Equal(t, &empty, args[0])
+}
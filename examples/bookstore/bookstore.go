@@ -12,15 +12,22 @@ import (
 //go:generate salgen -destination=./sal_client.go -package=github.com/go-gad/sal/examples/bookstore github.com/go-gad/sal/examples/bookstore Store
 type Store interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, error)
+	RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error
 	sal.Txer
 
 	CreateAuthor(context.Context, CreateAuthorReq) (CreateAuthorResp, error)
 	CreateAuthorPtr(context.Context, CreateAuthorReq) (*CreateAuthorResp, error)
 	GetAuthors(context.Context, GetAuthorsReq) ([]*GetAuthorsResp, error)
+	GetAuthorsEach(context.Context, GetAuthorsReq, func(*GetAuthorsResp) error) error
+	ExportAuthors(context.Context, ExportAuthorsReq, func([]*GetAuthorsResp) error) error
 	UpdateAuthor(context.Context, *UpdateAuthorReq) error
 	UpdateAuthorResult(context.Context, *UpdateAuthorReq) (sql.Result, error)
 	SameName(context.Context, SameNameReq) (*SameNameResp, error)
 	GetBooks(context.Context, GetBooksReq) ([]*GetBooksResp, error)
+	CopyBooks(context.Context, []*Book) (int64, error)
+	AddBooks(context.Context, *AddBooksReq) (sql.Result, error)
+	AddBooksCount(context.Context, *AddBooksCountReq) (*AddBooksCountResp, error)
+	DeleteAuthors(context.Context, *DeleteAuthorsReq) (sql.Result, error)
 }
 
 type BaseAuthor struct {
@@ -36,6 +43,9 @@ func (cr *CreateAuthorReq) Query() string {
 	return `INSERT INTO authors (Name, Desc, CreatedAt) VALUES(@Name, @Desc, now()) RETURNING ID, CreatedAt`
 }
 
+// ReadPrimary routes the query to the primary, it inserts the row though it returns the rows.
+func (cr *CreateAuthorReq) ReadPrimary() {}
+
 type CreateAuthorResp struct {
 	ID        int64
 	CreatedAt time.Time
@@ -58,6 +68,19 @@ func (r *GetAuthorsReq) Query() string {
 	return `SELECT id, created_at, name, desc, tags FROM authors WHERE id>@id AND tags @> @tags`
 }
 
+type ExportAuthorsReq struct {
+	Since time.Time `sql:"since"`
+}
+
+func (r *ExportAuthorsReq) Query() string {
+	return `SELECT id, created_at, name, desc, tags FROM authors WHERE created_at>=@since ORDER BY id`
+}
+
+// FetchSize sets the size of batches of rows read with the cursor.
+func (r *ExportAuthorsReq) FetchSize() int {
+	return 2
+}
+
 type GetAuthorsResp struct {
 	ID        int64     `sql:"id"`
 	CreatedAt time.Time `sql:"created_at"`
@@ -104,3 +127,56 @@ type GetBooksResp struct {
 	ID    int64  `sql:"id"`
 	Title string `sql:"title"`
 }
+
+// Book is the row of table books that is inserted by CopyBooks.
+type Book struct {
+	ID    int64  `sql:"id"`
+	Title string `sql:"title"`
+	Tags
+}
+
+func (b *Book) TableName() string {
+	return "books"
+}
+
+func (b *Book) ProcessRow(rowMap sal.RowMap) {
+	rowMap.Set("tags", pq.Array(b.Tags.Tags))
+}
+
+// AddBooksReq inserts the books with one multi-row INSERT.
+type AddBooksReq struct {
+	Books []*Book `sql:"books,batch"`
+}
+
+func (r *AddBooksReq) Query() string {
+	return `INSERT INTO books (id, title, tags) VALUES @books`
+}
+
+// AddBooksCountReq inserts the books and returns the number of inserted ones.
+type AddBooksCountReq struct {
+	Books []*Book `sql:"books,batch"`
+}
+
+func (r *AddBooksCountReq) Query() string {
+	return `WITH ins AS (INSERT INTO books (id, title, tags) VALUES @books RETURNING id) SELECT count(*) AS count FROM ins`
+}
+
+// AddBooksCountResp is the number of inserted books returned by AddBooksCount.
+type AddBooksCountResp struct {
+	Count int64 `sql:"count"`
+}
+
+type DeleteAuthorsReq struct {
+	Tags []int64 `sql:"tags"`
+}
+
+func (r *DeleteAuthorsReq) ProcessRow(rowMap sal.RowMap) {
+	rowMap.Set("tags", pq.Array(r.Tags))
+}
+
+func (r *DeleteAuthorsReq) Query() string {
+	return `DELETE FROM authors WHERE tags && @tags`
+}
+
+// NoPrepare disables preparing of the statement, the query is rarely used.
+func (r *DeleteAuthorsReq) NoPrepare() {}
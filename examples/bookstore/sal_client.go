@@ -27,18 +27,23 @@ func NewStore(h sal.QueryHandler, options ...sal.ClientOption) *SalStore {
 }
 
 func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, error) {
-	dbConn, ok := s.handler.(sal.TransactionBegin)
-	if !ok {
-		return nil, errors.New("handler doesn't satisfy the interface TransactionBegin")
-	}
 	var (
 		err error
-		tx  *sql.Tx
+		tx  sal.SqlTx
 	)
 
 	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Begin")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "BeginTx")
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "BeginTx",
+		Type:      sal.OperationTypeBegin,
+		RawQuery:  "BEGIN",
+		Query:     "BEGIN",
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -48,15 +53,34 @@ func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, err
 		}
 	}
 
-	tx, err = dbConn.BeginTx(ctx, opts)
+	op := &sal.Operation{
+		Method:   "BeginTx",
+		Type:     sal.OperationTypeBegin,
+		Query:    "BEGIN",
+		Response: &tx,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		tx, err = s.ctrl.BeginTx(ctx, s.handler, opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to start tx")
+		}
+		return nil
+	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to start tx")
+		err = s.ctrl.HandleError(ctx, err)
 		return nil, err
 	}
 
+	// the nested transaction keeps the parent of transaction to prepare statements.
+	parent := s.handler
+	if s.txOpened {
+		parent = s.parent
+	}
 	newClient := &SalStore{
 		handler:  tx,
-		parent:   s.handler,
+		parent:   parent,
 		ctrl:     s.ctrl,
 		txOpened: true,
 	}
@@ -71,25 +95,184 @@ func (s *SalStore) Tx() sal.Transaction {
 	return nil
 }
 
-func (s *SalStore) CreateAuthor(ctx context.Context, req CreateAuthorReq) (CreateAuthorResp, error) {
+func (s *SalStore) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	run := func(ctx context.Context) error {
+		client, err := s.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+			return fn(client)
+		})
+	}
+	// the nested transaction can't be retried, the error aborts the whole transaction.
+	if s.txOpened {
+		return run(ctx)
+	}
+	return s.ctrl.Retry(ctx, run)
+}
+func (s *SalStore) AddBooks(ctx context.Context, req *AddBooksReq) (sql.Result, error) {
+	// the rows of batch are bound by chunks to keep the number of args under the limit of database.
+	if len(req.Books) == 0 {
+		return sal.BatchResult{}, nil
+	}
+	size := s.ctrl.BatchSize(req.Query(), "books", 3)
+	if size == 0 {
+		return nil, &sal.BatchSizeError{Name: "books", Rows: len(req.Books), Max: size}
+	}
+	if len(req.Books) > size {
+		if !s.txOpened {
+			client, err := s.BeginTx(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			var res sql.Result
+			err = sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+				var err error
+				res, err = client.AddBooks(ctx, req)
+				return err
+			})
+			return res, err
+		}
+		var res sal.BatchResult
+		for start := 0; start < len(req.Books); start += size {
+			end := start + size
+			if end > len(req.Books) {
+				end = len(req.Books)
+			}
+			chunk := *req
+			chunk.Books = req.Books[start:end]
+			part, err := s.AddBooks(ctx, &chunk)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, part)
+		}
+		return res, nil
+	}
+
 	var (
 		err      error
 		rawQuery = req.Query()
 		reqMap   = make(sal.RowMap)
 	)
-	reqMap.AppendTo("Name", &req.BaseAuthor.Name)
-	reqMap.AppendTo("Desc", &req.BaseAuthor.Desc)
+	batchBooks := sal.Batch{Cols: []string{"id", "title", "tags"}, Rows: make([][]interface{}, 0, len(req.Books))}
+	for _, item := range req.Books {
+		item := item
+		var rowMap = make(sal.RowMap)
+		rowMap.AppendTo("id", &item.ID)
+		rowMap.AppendTo("title", &item.Title)
+		rowMap.AppendTo("tags", &item.Tags.Tags)
+
+		item.ProcessRow(rowMap)
+
+		batchBooks.Rows = append(batchBooks.Rows, rowMap.Values(batchBooks.Cols))
+	}
+	reqMap.AppendTo("books", batchBooks)
 
 	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
-	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
-	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "CreateAuthor")
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Exec")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "AddBooks")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "AddBooks",
+		Type:      sal.OperationTypeExec,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
+
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, rawQuery, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
+		}
+	}
+
+	var res sql.Result
+	op := &sal.Operation{
+		Method:   "AddBooks",
+		Type:     sal.OperationTypeExec,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &res,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		res, err = stmt.ExecContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Exec")
+		}
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
+		s.ctrl.HandleExecResult(ctx, res)
 
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
+		return nil
+	})
 	if err != nil {
-		return CreateAuthorResp{}, errors.WithStack(err)
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *SalStore) AddBooksCount(ctx context.Context, req *AddBooksCountReq) (*AddBooksCountResp, error) {
+	// the batch of single-row query isn't split to chunks.
+	if len(req.Books) == 0 {
+		return nil, sal.ErrEmptyBatch
+	}
+	if size := s.ctrl.BatchSize(req.Query(), "books", 3); len(req.Books) > size {
+		return nil, &sal.BatchSizeError{Name: "books", Rows: len(req.Books), Max: size}
+	}
+
+	var (
+		err      error
+		rawQuery = req.Query()
+		reqMap   = make(sal.RowMap)
+	)
+	batchBooks := sal.Batch{Cols: []string{"id", "title", "tags"}, Rows: make([][]interface{}, 0, len(req.Books))}
+	for _, item := range req.Books {
+		item := item
+		var rowMap = make(sal.RowMap)
+		rowMap.AppendTo("id", &item.ID)
+		rowMap.AppendTo("title", &item.Title)
+		rowMap.AppendTo("tags", &item.Tags.Tags)
+
+		item.ProcessRow(rowMap)
+
+		batchBooks.Rows = append(batchBooks.Rows, rowMap.Values(batchBooks.Cols))
 	}
+	reqMap.AppendTo("books", batchBooks)
+
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "AddBooksCount")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "AddBooksCount",
+		Type:      sal.OperationTypeQueryRow,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -99,37 +282,234 @@ func (s *SalStore) CreateAuthor(ctx context.Context, req CreateAuthorReq) (Creat
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
+	var resp AddBooksCountResp
+	op := &sal.Operation{
+		Method:   "AddBooksCount",
+		Type:     sal.OperationTypeQueryRow,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &resp,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
+
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "rows error")
+			}
+			return sql.ErrNoRows
+		}
+
+		var respMap = make(sal.RowMap)
+		respMap.AppendTo("count", &resp.Count)
+
+		dest := sal.GetDests(cols, respMap)
+
+		if err = rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, 1, &resp)
+
+		return nil
+	})
 	if err != nil {
-		return CreateAuthorResp{}, errors.Wrap(err, "failed to execute Query")
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (s *SalStore) CopyBooks(ctx context.Context, req []*Book) (int64, error) {
+	// the rows are inserted in the transaction.
+	if !s.txOpened {
+		client, err := s.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		var n int64
+		err = sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+			var err error
+			n, err = client.CopyBooks(ctx, req)
+			return err
+		})
+		return n, err
+	}
+
+	var (
+		err   error
+		n     int64
+		table = new(Book).TableName()
+		cols  = []string{"id", "title", "tags"}
+		rows  = make([][]interface{}, 0, len(req))
+	)
+	for _, item := range req {
+		item := item
+		var rowMap = make(sal.RowMap)
+		rowMap.AppendTo("id", &item.ID)
+		rowMap.AppendTo("title", &item.Title)
+		rowMap.AppendTo("tags", &item.Tags.Tags)
+
+		item.ProcessRow(rowMap)
+
+		rows = append(rows, rowMap.Values(cols))
 	}
-	defer rows.Close()
 
-	cols, err := rows.Columns()
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Copy")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "CopyBooks")
+
+	query := s.ctrl.CopyQuery(table, cols)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "CopyBooks",
+		Type:      sal.OperationTypeCopy,
+		RawQuery:  query,
+		Query:     query,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
+
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, query, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
+		}
+	}
+
+	op := &sal.Operation{
+		Method:   "CopyBooks",
+		Type:     sal.OperationTypeCopy,
+		Query:    query,
+		Request:  req,
+		Response: &n,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		n, err = s.ctrl.CopyFrom(ctx, s.handler, table, cols, rows)
+		return err
+	})
 	if err != nil {
-		return CreateAuthorResp{}, errors.Wrap(err, "failed to fetch columns")
+		err = s.ctrl.HandleError(ctx, err)
+		return 0, err
 	}
 
-	if !rows.Next() {
-		if err = rows.Err(); err != nil {
-			return CreateAuthorResp{}, errors.Wrap(err, "rows error")
+	return n, nil
+}
+
+func (s *SalStore) CreateAuthor(ctx context.Context, req CreateAuthorReq) (CreateAuthorResp, error) {
+	var (
+		err      error
+		rawQuery = req.Query()
+		reqMap   = make(sal.RowMap)
+	)
+	reqMap.AppendTo("Name", &req.BaseAuthor.Name)
+	reqMap.AppendTo("Desc", &req.BaseAuthor.Desc)
+
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "CreateAuthor")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "CreateAuthor",
+		Type:      sal.OperationTypeQueryRow,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Primary:   true,
+		Tx:        s.Tx(),
+	})
+
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, rawQuery, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
 		}
-		return CreateAuthorResp{}, sql.ErrNoRows
 	}
 
 	var resp CreateAuthorResp
-	var respMap = make(sal.RowMap)
-	respMap.AppendTo("ID", &resp.ID)
-	respMap.AppendTo("CreatedAt", &resp.CreatedAt)
+	op := &sal.Operation{
+		Method:   "CreateAuthor",
+		Type:     sal.OperationTypeQueryRow,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &resp,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	dest := sal.GetDests(cols, respMap)
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	if err = rows.Scan(dest...); err != nil {
-		return CreateAuthorResp{}, errors.Wrap(err, "failed to scan row")
-	}
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
+
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "rows error")
+			}
+			return sql.ErrNoRows
+		}
 
-	if err = rows.Err(); err != nil {
-		return CreateAuthorResp{}, errors.Wrap(err, "something failed during iteration")
+		var respMap = make(sal.RowMap)
+		respMap.AppendTo("ID", &resp.ID)
+		respMap.AppendTo("CreatedAt", &resp.CreatedAt)
+
+		dest := sal.GetDests(cols, respMap)
+
+		if err = rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, 1, resp)
+
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return CreateAuthorResp{}, err
 	}
 
 	return resp, nil
@@ -148,13 +528,115 @@ func (s *SalStore) CreateAuthorPtr(ctx context.Context, req CreateAuthorReq) (*C
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "CreateAuthorPtr")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "CreateAuthorPtr",
+		Type:      sal.OperationTypeQueryRow,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Primary:   true,
+		Tx:        s.Tx(),
+	})
+
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, rawQuery, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
+		}
+	}
+
+	var resp CreateAuthorResp
+	op := &sal.Operation{
+		Method:   "CreateAuthorPtr",
+		Type:     sal.OperationTypeQueryRow,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &resp,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
+
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "rows error")
+			}
+			return sql.ErrNoRows
+		}
+
+		var respMap = make(sal.RowMap)
+		respMap.AppendTo("ID", &resp.ID)
+		respMap.AppendTo("CreatedAt", &resp.CreatedAt)
+
+		dest := sal.GetDests(cols, respMap)
+
+		if err = rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, 1, &resp)
+
+		return nil
+	})
 	if err != nil {
-		return nil, errors.WithStack(err)
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
+	return &resp, nil
+}
+
+func (s *SalStore) DeleteAuthors(ctx context.Context, req *DeleteAuthorsReq) (sql.Result, error) {
+	var (
+		err      error
+		rawQuery = req.Query()
+		reqMap   = make(sal.RowMap)
+	)
+	reqMap.AppendTo("tags", &req.Tags)
+
+	req.ProcessRow(reqMap)
+
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Exec")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "DeleteAuthors")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "DeleteAuthors",
+		Type:      sal.OperationTypeExec,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
+
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
 		ctx, fnz = fn(ctx, rawQuery, req)
@@ -163,40 +645,174 @@ func (s *SalStore) CreateAuthorPtr(ctx context.Context, req CreateAuthorReq) (*C
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var res sql.Result
+	op := &sal.Operation{
+		Method:   "DeleteAuthors",
+		Type:     sal.OperationTypeExec,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &res,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		stmt := sal.DirectStmt(s.handler, op.Query)
+
+		res, err = stmt.ExecContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Exec")
+		}
 
-	cols, err := rows.Columns()
+		s.ctrl.HandleExecResult(ctx, res)
+
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
-	if !rows.Next() {
-		if err = rows.Err(); err != nil {
-			return nil, errors.Wrap(err, "rows error")
+	return res, nil
+}
+
+func (s *SalStore) ExportAuthors(ctx context.Context, req ExportAuthorsReq, callback func([]*GetAuthorsResp) error) error {
+	// the cursor exists only in the transaction.
+	if !s.txOpened {
+		client, err := s.BeginTx(ctx, nil)
+		if err != nil {
+			return err
 		}
-		return nil, sql.ErrNoRows
+		return sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+			return client.ExportAuthors(ctx, req, callback)
+		})
 	}
 
-	var resp CreateAuthorResp
-	var respMap = make(sal.RowMap)
-	respMap.AppendTo("ID", &resp.ID)
-	respMap.AppendTo("CreatedAt", &resp.CreatedAt)
+	var (
+		err      error
+		rawQuery = req.Query()
+		reqMap   = make(sal.RowMap)
+	)
+	reqMap.AppendTo("since", &req.Since)
 
-	dest := sal.GetDests(cols, respMap)
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Query")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "ExportAuthors")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "ExportAuthors",
+		Type:      sal.OperationTypeQuery,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
-	if err = rows.Scan(dest...); err != nil {
-		return nil, errors.Wrap(err, "failed to scan row")
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, rawQuery, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
+		}
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+	op := &sal.Operation{
+		Method:  "ExportAuthors",
+		Type:    sal.OperationTypeQuery,
+		Query:   query,
+		Args:    args,
+		Request: req,
+		Handler: s.handler,
 	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		cur, err := sal.DeclareCursor(ctx, s.handler, op.Query, op.Args...)
+		if err != nil {
+			return err
+		}
 
-	return &resp, nil
+		scan := func(rows *sql.Rows) ([]*GetAuthorsResp, error) {
+			defer rows.Close()
+
+			cols, err := rows.Columns()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to fetch columns")
+			}
+
+			var list = make([]*GetAuthorsResp, 0)
+			for rows.Next() {
+				var resp GetAuthorsResp
+				var respMap = make(sal.RowMap)
+				respMap.AppendTo("id", &resp.ID)
+				respMap.AppendTo("created_at", &resp.CreatedAt)
+				respMap.AppendTo("name", &resp.Name)
+				respMap.AppendTo("desc", &resp.Desc)
+				respMap.AppendTo("tags", &resp.Tags.Tags)
+
+				resp.ProcessRow(respMap)
+
+				dest := sal.GetDests(cols, respMap)
+
+				if err = rows.Scan(dest...); err != nil {
+					return nil, errors.Wrap(err, "failed to scan row")
+				}
+
+				list = append(list, &resp)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, errors.Wrap(err, "something failed during iteration")
+			}
+
+			return list, nil
+		}
+
+		var (
+			count int
+			size  = sal.FetchSizeOf(&req)
+		)
+		for {
+			rows, err := cur.Fetch(ctx, size)
+			if err != nil {
+				return err
+			}
+			list, err := scan(rows)
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				break
+			}
+			count += len(list)
+
+			if err = callback(list); err != nil {
+				if err == sal.ErrStopIteration {
+					break
+				}
+				return err
+			}
+			if len(list) < size {
+				break
+			}
+		}
+
+		if err = cur.Close(ctx); err != nil {
+			return err
+		}
+
+		s.ctrl.HandleQueryResult(ctx, count, nil)
+
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return err
+	}
+
+	return nil
 }
 
 func (s *SalStore) GetAuthors(ctx context.Context, req GetAuthorsReq) ([]*GetAuthorsResp, error) {
@@ -214,12 +830,18 @@ func (s *SalStore) GetAuthors(ctx context.Context, req GetAuthorsReq) ([]*GetAut
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Query")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "GetAuthors")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "GetAuthors",
+		Type:      sal.OperationTypeQuery,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -229,44 +851,174 @@ func (s *SalStore) GetAuthors(ctx context.Context, req GetAuthorsReq) ([]*GetAut
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var list = make([]*GetAuthorsResp, 0)
+	op := &sal.Operation{
+		Method:   "GetAuthors",
+		Type:     sal.OperationTypeQuery,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &list,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
+
+		for rows.Next() {
+			var resp GetAuthorsResp
+			var respMap = make(sal.RowMap)
+			respMap.AppendTo("id", &resp.ID)
+			respMap.AppendTo("created_at", &resp.CreatedAt)
+			respMap.AppendTo("name", &resp.Name)
+			respMap.AppendTo("desc", &resp.Desc)
+			respMap.AppendTo("tags", &resp.Tags.Tags)
+
+			resp.ProcessRow(respMap)
+
+			dest := sal.GetDests(cols, respMap)
+
+			if err = rows.Scan(dest...); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
 
-	cols, err := rows.Columns()
+			list = append(list, &resp)
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, len(list), list)
+
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
-	var list = make([]*GetAuthorsResp, 0)
+	return list, nil
+}
 
-	for rows.Next() {
-		var resp GetAuthorsResp
-		var respMap = make(sal.RowMap)
-		respMap.AppendTo("id", &resp.ID)
-		respMap.AppendTo("created_at", &resp.CreatedAt)
-		respMap.AppendTo("name", &resp.Name)
-		respMap.AppendTo("desc", &resp.Desc)
-		respMap.AppendTo("tags", &resp.Tags.Tags)
+func (s *SalStore) GetAuthorsEach(ctx context.Context, req GetAuthorsReq, callback func(*GetAuthorsResp) error) error {
+	var (
+		err      error
+		rawQuery = req.Query()
+		reqMap   = make(sal.RowMap)
+	)
+	reqMap.AppendTo("id", &req.ID)
+	reqMap.AppendTo("tags", &req.Tags.Tags)
 
-		resp.ProcessRow(respMap)
+	req.ProcessRow(reqMap)
 
-		dest := sal.GetDests(cols, respMap)
+	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
+	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Query")
+	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "GetAuthorsEach")
+
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "GetAuthorsEach",
+		Type:      sal.OperationTypeQuery,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
-		if err = rows.Scan(dest...); err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+	for _, fn := range s.ctrl.BeforeQuery {
+		var fnz sal.FinalizerFunc
+		ctx, fnz = fn(ctx, rawQuery, req)
+		if fnz != nil {
+			defer func() { fnz(ctx, err) }()
 		}
+	}
 
-		list = append(list, &resp)
+	op := &sal.Operation{
+		Method:  "GetAuthorsEach",
+		Type:    sal.OperationTypeQuery,
+		Query:   query,
+		Args:    args,
+		Request: req,
+		Handler: s.handler,
 	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
+
+		var count int
+		for rows.Next() {
+			if err = ctx.Err(); err != nil {
+				return errors.Wrap(err, "iteration is interrupted")
+			}
+			var resp GetAuthorsResp
+			var respMap = make(sal.RowMap)
+			respMap.AppendTo("id", &resp.ID)
+			respMap.AppendTo("created_at", &resp.CreatedAt)
+			respMap.AppendTo("name", &resp.Name)
+			respMap.AppendTo("desc", &resp.Desc)
+			respMap.AppendTo("tags", &resp.Tags.Tags)
+
+			resp.ProcessRow(respMap)
+
+			dest := sal.GetDests(cols, respMap)
+
+			if err = rows.Scan(dest...); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
+			count++
+
+			if err = callback(&resp); err != nil {
+				if err == sal.ErrStopIteration {
+					break
+				}
+				return err
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, count, nil)
+
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return err
 	}
 
-	return list, nil
+	return nil
 }
 
 func (s *SalStore) GetBooks(ctx context.Context, req GetBooksReq) ([]*GetBooksResp, error) {
@@ -280,12 +1032,18 @@ func (s *SalStore) GetBooks(ctx context.Context, req GetBooksReq) ([]*GetBooksRe
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Query")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "GetBooks")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "GetBooks",
+		Type:      sal.OperationTypeQuery,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -295,36 +1053,59 @@ func (s *SalStore) GetBooks(ctx context.Context, req GetBooksReq) ([]*GetBooksRe
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var list = make([]*GetBooksResp, 0)
+	op := &sal.Operation{
+		Method:   "GetBooks",
+		Type:     sal.OperationTypeQuery,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &list,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
-	}
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	var list = make([]*GetBooksResp, 0)
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
 
-	for rows.Next() {
-		var resp GetBooksResp
-		var respMap = make(sal.RowMap)
-		respMap.AppendTo("id", &resp.ID)
-		respMap.AppendTo("title", &resp.Title)
+		for rows.Next() {
+			var resp GetBooksResp
+			var respMap = make(sal.RowMap)
+			respMap.AppendTo("id", &resp.ID)
+			respMap.AppendTo("title", &resp.Title)
 
-		dest := sal.GetDests(cols, respMap)
+			dest := sal.GetDests(cols, respMap)
 
-		if err = rows.Scan(dest...); err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+			if err = rows.Scan(dest...); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
+
+			list = append(list, &resp)
 		}
 
-		list = append(list, &resp)
-	}
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, len(list), list)
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
 	return list, nil
@@ -341,12 +1122,18 @@ func (s *SalStore) SameName(ctx context.Context, req SameNameReq) (*SameNameResp
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "SameName")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "SameName",
+		Type:      sal.OperationTypeQueryRow,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -356,37 +1143,61 @@ func (s *SalStore) SameName(ctx context.Context, req SameNameReq) (*SameNameResp
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var resp SameNameResp
+	op := &sal.Operation{
+		Method:   "SameName",
+		Type:     sal.OperationTypeQueryRow,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &resp,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
-	}
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	if !rows.Next() {
-		if err = rows.Err(); err != nil {
-			return nil, errors.Wrap(err, "rows error")
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
 		}
-		return nil, sql.ErrNoRows
-	}
 
-	var resp SameNameResp
-	var respMap = make(sal.RowMap)
-	respMap.AppendTo("Bar", &resp.Bar)
-	respMap.AppendTo("Bar", &resp.Foo.Bar)
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "rows error")
+			}
+			return sql.ErrNoRows
+		}
 
-	dest := sal.GetDests(cols, respMap)
+		var respMap = make(sal.RowMap)
+		respMap.AppendTo("Bar", &resp.Bar)
+		respMap.AppendTo("Bar", &resp.Foo.Bar)
 
-	if err = rows.Scan(dest...); err != nil {
-		return nil, errors.Wrap(err, "failed to scan row")
-	}
+		dest := sal.GetDests(cols, respMap)
+
+		if err = rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, 1, &resp)
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
 	return &resp, nil
@@ -406,12 +1217,18 @@ func (s *SalStore) UpdateAuthor(ctx context.Context, req *UpdateAuthorReq) error
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Exec")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "UpdateAuthor")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "UpdateAuthor",
+		Type:      sal.OperationTypeExec,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -421,9 +1238,35 @@ func (s *SalStore) UpdateAuthor(ctx context.Context, req *UpdateAuthorReq) error
 		}
 	}
 
-	_, err = stmt.ExecContext(ctx, args...)
+	var res sql.Result
+	op := &sal.Operation{
+		Method:   "UpdateAuthor",
+		Type:     sal.OperationTypeExec,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &res,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		res, err = stmt.ExecContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Exec")
+		}
+
+		s.ctrl.HandleExecResult(ctx, res)
+
+		return nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to execute Exec")
+		err = s.ctrl.HandleError(ctx, err)
+		return err
 	}
 
 	return nil
@@ -443,12 +1286,18 @@ func (s *SalStore) UpdateAuthorResult(ctx context.Context, req *UpdateAuthorReq)
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Exec")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "UpdateAuthorResult")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "UpdateAuthorResult",
+		Type:      sal.OperationTypeExec,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -458,9 +1307,35 @@ func (s *SalStore) UpdateAuthorResult(ctx context.Context, req *UpdateAuthorReq)
 		}
 	}
 
-	res, err := stmt.ExecContext(ctx, args...)
+	var res sql.Result
+	op := &sal.Operation{
+		Method:   "UpdateAuthorResult",
+		Type:     sal.OperationTypeExec,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &res,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		res, err = stmt.ExecContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Exec")
+		}
+
+		s.ctrl.HandleExecResult(ctx, res)
+
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Exec")
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
 	return res, nil
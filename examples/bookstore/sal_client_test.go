@@ -2,12 +2,15 @@ package bookstore
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/go-gad/sal"
 	"github.com/lib/pq"
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
@@ -215,3 +218,743 @@ func TestSalStore_GetBooks(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Nil(t, mock.ExpectationsWereMet())
 }
+
+func TestSalStore_DeleteAuthors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	client := NewStore(db)
+
+	req := DeleteAuthorsReq{Tags: []int64{1, 2}}
+
+	// the request implements sal.NoPreparer, so the query is executed without preparing
+	mock.ExpectExec(`DELETE FROM authors .+`).WithArgs(pq.Array(req.Tags)).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	res, err := client.DeleteAuthors(context.Background(), &req)
+	assert.Nil(t, err)
+	affected, err := res.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), affected)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_SkipPrepare(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	client := NewStore(db, sal.SkipPrepare())
+
+	req1 := CreateAuthorReq{BaseAuthor{Name: "foo", Desc: "Bar"}}
+	rows := sqlmock.NewRows([]string{"ID", "CreatedAt"}).AddRow(int64(1), time.Now().Truncate(time.Millisecond))
+	req2 := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO authors .+`).WithArgs(req1.Name, req1.Desc).WillReturnRows(rows)
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req2.Name, req2.Desc, req2.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+
+	tx, err := client.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+
+	_, err = tx.CreateAuthor(ctx, req1)
+	assert.Nil(t, err)
+
+	err = tx.UpdateAuthor(ctx, &req2)
+	assert.Nil(t, err)
+
+	err = tx.Tx().Commit(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_Hooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var (
+		affected    int64
+		rowsCount   int
+		response    interface{}
+		finalErr    error
+		errNotFound = errors.New("not found")
+	)
+	client := NewStore(db,
+		sal.BeforeQuery(func(ctx context.Context, query string, req interface{}) (context.Context, sal.FinalizerFunc) {
+			return ctx, func(ctx context.Context, err error) { finalErr = err }
+		}),
+		sal.AfterExec(func(ctx context.Context, res sql.Result) {
+			affected, _ = res.RowsAffected()
+		}),
+		sal.AfterQuery(func(ctx context.Context, rows int, resp interface{}) {
+			rowsCount, response = rows, resp
+		}),
+		sal.OnError(func(ctx context.Context, err error) error {
+			if err == sql.ErrNoRows {
+				return errNotFound
+			}
+			return nil
+		}),
+	)
+	ctx := context.Background()
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 7))
+	assert.Nil(t, client.UpdateAuthor(ctx, &req))
+	assert.Equal(t, int64(7), affected)
+
+	mock.ExpectPrepare(`SELECT \* FROM books`)
+	mock.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "foo").AddRow(2, "bar"))
+	books, err := client.GetBooks(ctx, GetBooksReq{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, rowsCount)
+	assert.Equal(t, books, response)
+
+	mock.ExpectPrepare(`SELECT.+`)
+	mock.ExpectQuery(`SELECT.+`).WillReturnRows(sqlmock.NewRows([]string{"Bar"}))
+	_, err = client.SameName(ctx, SameNameReq{})
+	assert.Equal(t, errNotFound, err)
+	assert.Equal(t, errNotFound, finalErr)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_Intercept(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var (
+		cached   = []*GetBooksResp{{ID: 1, Title: "cached"}}
+		attempts int
+	)
+	client := NewStore(db,
+		sal.Intercept(func(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+			if op.Method == "GetBooks" {
+				*op.Response.(*[]*GetBooksResp) = cached
+				return nil
+			}
+			return next(ctx, op)
+		}),
+		sal.Intercept(func(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+			err := next(ctx, op)
+			for attempts = 1; err != nil && attempts < 3; attempts++ {
+				err = next(ctx, op)
+			}
+			return err
+		}),
+	)
+	ctx := context.Background()
+
+	books, err := client.GetBooks(ctx, GetBooksReq{})
+	assert.Nil(t, err)
+	assert.Equal(t, cached, books)
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnError(errors.New("conn reset"))
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, client.UpdateAuthor(ctx, &req))
+	assert.Equal(t, 2, attempts)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_OperationInfo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var infos []sal.OperationInfo
+	client := NewStore(db, sal.BeforeQuery(func(ctx context.Context, query string, req interface{}) (context.Context, sal.FinalizerFunc) {
+		if info, ok := sal.OperationFromContext(ctx); ok {
+			infos = append(infos, *info)
+		}
+		return ctx, nil
+	}))
+	ctx := context.Background()
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, client.UpdateAuthor(ctx, &req))
+
+	if assert.Len(t, infos, 2) {
+		info := infos[0]
+		assert.Equal(t, "Store", info.Interface)
+		assert.Equal(t, "UpdateAuthor", info.Method)
+		assert.Equal(t, sal.OperationTypeExec, info.Type)
+		assert.Equal(t, req.Query(), info.RawQuery)
+		assert.Equal(t, "UPDATE authors SET Name=$1, Desc=$2 WHERE ID=$3", info.Query)
+		assert.Equal(t, []interface{}{&req.Name, &req.Desc, &req.ID}, info.Args)
+		assert.False(t, info.TxOpened)
+		assert.False(t, info.StartedAt.IsZero())
+
+		prepare := infos[1]
+		assert.Equal(t, "UpdateAuthor", prepare.Method)
+		assert.Equal(t, sal.OperationTypePrepare, prepare.Type)
+		assert.Equal(t, info.Query, prepare.Query)
+	}
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_RunInTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	client := NewStore(db, sal.WithRetryPolicy(sal.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+	ctx := context.Background()
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	// the statement is prepared with db and then with the connection of tx.
+	mock.ExpectBegin()
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var attempts int
+	err = client.RunInTx(ctx, nil, func(tx Store) error {
+		attempts++
+		return tx.UpdateAuthor(ctx, &req)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_NestedTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	client := NewStore(db)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	tx, err := client.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	nested, err := tx.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, nested.UpdateAuthor(ctx, &req))
+
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, nested.Tx().Rollback(ctx))
+	assert.Equal(t, sql.ErrTxDone, nested.Tx().Commit(ctx))
+
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = tx.RunInTx(ctx, nil, func(tx Store) error {
+		return tx.UpdateAuthor(ctx, &req)
+	})
+	assert.Nil(t, err)
+
+	mock.ExpectCommit()
+	assert.Nil(t, tx.Tx().Commit(ctx))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_TxCallbacks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var events []string
+	client := NewStore(db, sal.Intercept(func(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+		if tx, ok := sal.TxFromContext(ctx); ok && op.Method == "UpdateAuthor" {
+			tx.AfterCommit(func(ctx context.Context) { events = append(events, "updated") })
+		}
+		return next(ctx, op)
+	}))
+	ctx := context.Background()
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectBegin()
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = client.RunInTx(ctx, nil, func(tx Store) error {
+		tx.Tx().AfterRollback(func(ctx context.Context) { events = append(events, "outer rolled back") })
+		if err := tx.UpdateAuthor(ctx, &req); err != nil {
+			return err
+		}
+		err := tx.RunInTx(ctx, nil, func(tx Store) error {
+			tx.Tx().AfterCommit(func(ctx context.Context) { events = append(events, "released") })
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.RunInTx(ctx, nil, func(tx Store) error {
+			tx.Tx().AfterCommit(func(ctx context.Context) { events = append(events, "rolled back to savepoint") })
+			tx.Tx().AfterRollback(func(ctx context.Context) { events = append(events, "nested rolled back") })
+			return errors.New("nested failed")
+		})
+		assert.EqualError(t, err, "nested failed")
+		// the callbacks of the nested transactions are called after the outcome of the outer one is known.
+		assert.Equal(t, []string{"nested rolled back"}, events)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nested rolled back", "updated", "released"}, events)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_Router(t *testing.T) {
+	var (
+		dbs   [3]*sql.DB
+		mocks [3]sqlmock.Sqlmock
+	)
+	for i := range dbs {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+		dbs[i], mocks[i] = db, mock
+	}
+	primary, replica1, replica2 := mocks[0], mocks[1], mocks[2]
+	router := sal.NewRouter(dbs[0], []sal.QueryHandler{dbs[1], dbs[2]})
+	client := NewStore(router)
+	defer client.ctrl.Close()
+	ctx := context.Background()
+
+	booksRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "title"}).AddRow(10, "foo-10")
+	}
+	// the reads are balanced across the replicas, the statements are prepared on each of them.
+	replica1.ExpectPrepare(`SELECT \* FROM books`)
+	replica1.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	replica2.ExpectPrepare(`SELECT \* FROM books`)
+	replica2.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	replica1.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	for i := 0; i < 3; i++ {
+		_, err := client.GetBooks(ctx, GetBooksReq{})
+		assert.Nil(t, err)
+	}
+
+	// the request of CreateAuthor is sal.PrimaryReader.
+	req1 := CreateAuthorReq{BaseAuthor{Name: "foo", Desc: "Bar"}}
+	primary.ExpectPrepare(`INSERT INTO authors .+`)
+	primary.ExpectQuery(`INSERT INTO authors .+`).WithArgs(req1.Name, req1.Desc).
+		WillReturnRows(sqlmock.NewRows([]string{"ID", "CreatedAt"}).AddRow(int64(1), time.Now()))
+	_, err := client.CreateAuthor(ctx, req1)
+	assert.Nil(t, err)
+
+	req2 := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	primary.ExpectPrepare("UPDATE authors SET.+")
+	primary.ExpectExec("UPDATE authors SET.+").WithArgs(req2.Name, req2.Desc, req2.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, client.UpdateAuthor(ctx, &req2))
+
+	// the reads in transaction go to the primary.
+	primary.ExpectBegin()
+	primary.ExpectPrepare(`SELECT \* FROM books`)
+	primary.ExpectPrepare(`SELECT \* FROM books`)
+	primary.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	primary.ExpectCommit()
+	err = client.RunInTx(ctx, nil, func(tx Store) error {
+		_, err := tx.GetBooks(ctx, GetBooksReq{})
+		return err
+	})
+	assert.Nil(t, err)
+
+	for _, mock := range mocks {
+		assert.Nil(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestSalStore_Shards(t *testing.T) {
+	var (
+		dbs   [2]*sql.DB
+		mocks [2]sqlmock.Sqlmock
+	)
+	for i := range dbs {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+		dbs[i], mocks[i] = db, mock
+	}
+	shards := sal.NewShards([]sal.QueryHandler{dbs[0], dbs[1]}, sal.ShardBy(func(key interface{}, n int) (int, error) {
+		return key.(int) % n, nil
+	}))
+	client := NewStore(shards)
+	defer client.ctrl.Close()
+	ctx0 := sal.WithShardKey(context.Background(), 2)
+	ctx1 := sal.WithShardKey(context.Background(), 1)
+
+	booksRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "title"}).AddRow(10, "foo-10")
+	}
+	// the statements are prepared and cached for each shard.
+	mocks[1].ExpectPrepare(`SELECT \* FROM books`)
+	mocks[1].ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	mocks[0].ExpectPrepare(`SELECT \* FROM books`)
+	mocks[0].ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	mocks[1].ExpectQuery(`SELECT \* FROM books`).WillReturnRows(booksRows())
+	for _, ctx := range []context.Context{ctx1, ctx0, ctx1} {
+		_, err := client.GetBooks(ctx, GetBooksReq{})
+		assert.Nil(t, err)
+	}
+
+	_, err := client.GetBooks(context.Background(), GetBooksReq{})
+	assert.Equal(t, sal.ErrNoShardKey, pkgerrors.Cause(err))
+
+	req := UpdateAuthorReq{ID: 123, BaseAuthor: BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mocks[0].ExpectBegin()
+	mocks[0].ExpectPrepare("UPDATE authors SET.+")
+	mocks[0].ExpectPrepare("UPDATE authors SET.+")
+	mocks[0].ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mocks[0].ExpectCommit()
+	err = client.RunInTx(ctx0, nil, func(tx Store) error {
+		return tx.UpdateAuthor(ctx0, &req)
+	})
+	assert.Nil(t, err)
+
+	for _, mock := range mocks {
+		assert.Nil(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestSalStore_GetAuthorsEach(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	var rowsCount = -1
+	client := NewStore(db, sal.AfterQuery(func(ctx context.Context, rows int, resp interface{}) {
+		rowsCount = rows
+	}))
+
+	req := GetAuthorsReq{ID: 123, Tags: Tags{Tags: []int64{33, 44, 55}}}
+	expResp := []*GetAuthorsResp{
+		&GetAuthorsResp{ID: 10, Name: "Bob", Desc: "d1", Tags: Tags{Tags: []int64{1, 2, 3}}, CreatedAt: time.Now().Truncate(time.Millisecond)},
+		&GetAuthorsResp{ID: 20, Name: "Jhn", Desc: "d2", Tags: Tags{Tags: []int64{4, 5, 6}}, CreatedAt: time.Now().Truncate(time.Millisecond)},
+		&GetAuthorsResp{ID: 30, Name: "Max", Desc: "d3", Tags: Tags{Tags: []int64{6, 7, 8}}, CreatedAt: time.Now().Truncate(time.Millisecond)},
+	}
+	newRows := func() *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"id", "created_at", "name", "desc", "tags"})
+		for _, v := range expResp {
+			rows = rows.AddRow(v.ID, v.CreatedAt, v.Name, v.Desc, dv(v.Tags.Tags))
+		}
+		return rows
+	}
+	ctx := context.Background()
+
+	mock.ExpectPrepare(`SELECT id, created_at, name,.+`)
+	mock.ExpectQuery(`SELECT id, created_at, name,.+`).WithArgs(req.ID, pq.Array(req.Tags.Tags)).WillReturnRows(newRows())
+	var resp []*GetAuthorsResp
+	err = client.GetAuthorsEach(ctx, req, func(row *GetAuthorsResp) error {
+		resp = append(resp, row)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, expResp, resp)
+	assert.Equal(t, 3, rowsCount)
+
+	// the iteration is stopped early, the rows are closed.
+	mock.ExpectQuery(`SELECT id, created_at, name,.+`).WithArgs(req.ID, pq.Array(req.Tags.Tags)).WillReturnRows(newRows())
+	resp = nil
+	err = client.GetAuthorsEach(ctx, req, func(row *GetAuthorsResp) error {
+		resp = append(resp, row)
+		return sal.ErrStopIteration
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, expResp[:1], resp)
+	assert.Equal(t, 1, rowsCount)
+	assert.Equal(t, 0, db.Stats().InUse)
+
+	// the error of callback is returned as is.
+	mock.ExpectQuery(`SELECT id, created_at, name,.+`).WithArgs(req.ID, pq.Array(req.Tags.Tags)).WillReturnRows(newRows())
+	errCallback := errors.New("callback failed")
+	err = client.GetAuthorsEach(ctx, req, func(row *GetAuthorsResp) error {
+		return errCallback
+	})
+	assert.Equal(t, errCallback, err)
+
+	// the cancellation of context interrupts the iteration.
+	mock.ExpectQuery(`SELECT id, created_at, name,.+`).WithArgs(req.ID, pq.Array(req.Tags.Tags)).WillReturnRows(newRows())
+	cctx, cancel := context.WithCancel(ctx)
+	var n int
+	err = client.GetAuthorsEach(cctx, req, func(row *GetAuthorsResp) error {
+		n++
+		cancel()
+		return nil
+	})
+	assert.Equal(t, context.Canceled, pkgerrors.Cause(err))
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.Stats().InUse)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_ExportAuthors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	client := NewStore(db)
+
+	req := ExportAuthorsReq{Since: time.Now().Truncate(time.Millisecond)}
+	expResp := []*GetAuthorsResp{
+		&GetAuthorsResp{ID: 10, Name: "Bob", Desc: "d1", Tags: Tags{Tags: []int64{1, 2, 3}}, CreatedAt: req.Since},
+		&GetAuthorsResp{ID: 20, Name: "Jhn", Desc: "d2", Tags: Tags{Tags: []int64{4, 5, 6}}, CreatedAt: req.Since},
+		&GetAuthorsResp{ID: 30, Name: "Max", Desc: "d3", Tags: Tags{Tags: []int64{6, 7, 8}}, CreatedAt: req.Since},
+	}
+	newRows := func(list []*GetAuthorsResp) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"id", "created_at", "name", "desc", "tags"})
+		for _, v := range list {
+			rows = rows.AddRow(v.ID, v.CreatedAt, v.Name, v.Desc, dv(v.Tags.Tags))
+		}
+		return rows
+	}
+	ctx := context.Background()
+
+	// the transaction is started for the cursor, the rows are fetched by batches of 2 rows.
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT id, created_at, name, desc, tags FROM authors WHERE created_at>=\$1 ORDER BY id`).
+		WithArgs(req.Since).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(expResp[:2]))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(expResp[2:]))
+	mock.ExpectExec(`CLOSE sal_cur_[0-9]+`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var batches [][]*GetAuthorsResp
+	err = client.ExportAuthors(ctx, req, func(list []*GetAuthorsResp) error {
+		batches = append(batches, list)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*GetAuthorsResp{expResp[:2], expResp[2:]}, batches)
+
+	// the full batch is followed by the fetch of empty batch that isn't passed to the callback.
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT .+`).
+		WithArgs(req.Since).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(expResp[:2]))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(nil))
+	mock.ExpectExec(`CLOSE sal_cur_[0-9]+`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	batches = nil
+	err = client.ExportAuthors(ctx, req, func(list []*GetAuthorsResp) error {
+		batches = append(batches, list)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*GetAuthorsResp{expResp[:2]}, batches)
+
+	// sal.ErrStopIteration stops the fetching without error.
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT .+`).
+		WithArgs(req.Since).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(expResp[:2]))
+	mock.ExpectExec(`CLOSE sal_cur_[0-9]+`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = client.ExportAuthors(ctx, req, func(list []*GetAuthorsResp) error {
+		return sal.ErrStopIteration
+	})
+	assert.Nil(t, err)
+
+	// the cursor is used in the opened transaction, the error of callback stops the fetching.
+	errCallback := errors.New("callback failed")
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE sal_cur_[0-9]+ NO SCROLL CURSOR FOR SELECT .+`).
+		WithArgs(req.Since).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM sal_cur_[0-9]+`).WillReturnRows(newRows(expResp[:2]))
+	mock.ExpectRollback()
+	err = client.RunInTx(ctx, nil, func(tx Store) error {
+		return tx.ExportAuthors(ctx, req, func(list []*GetAuthorsResp) error {
+			return errCallback
+		})
+	})
+	assert.Equal(t, errCallback, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_CopyBooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	books := []*Book{
+		{ID: 1, Title: "foo", Tags: Tags{Tags: []int64{1, 2}}},
+		{ID: 2, Title: "bar", Tags: Tags{Tags: []int64{3}}},
+	}
+
+	client := NewStore(db)
+	mock.ExpectBegin()
+	mock.ExpectPrepare(`COPY "books" \("id", "title", "tags"\) FROM STDIN`)
+	mock.ExpectExec(`COPY "books"`).WithArgs(int64(1), "foo", dv([]int64{1, 2})).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`COPY "books"`).WithArgs(int64(2), "bar", dv([]int64{3})).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`COPY "books"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	n, err := client.CopyBooks(ctx, books)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// without COPY the rows are inserted with the multi-row INSERT.
+	client = NewStore(db, sal.SkipCopy())
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "books" \("id", "title", "tags"\) VALUES \(\$1, \$2, \$3\), \(\$4, \$5, \$6\)`).
+		WithArgs(int64(1), "foo", dv([]int64{1, 2}), int64(2), "bar", dv([]int64{3})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	n, err = client.CopyBooks(ctx, books)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_AddBooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	req := &AddBooksReq{Books: []*Book{
+		{ID: 1, Title: "foo", Tags: Tags{Tags: []int64{1, 2}}},
+		{ID: 2, Title: "bar", Tags: Tags{Tags: []int64{3}}},
+	}}
+
+	client := NewStore(db)
+	mock.ExpectPrepare(`INSERT INTO books \(id, title, tags\) VALUES \(\$1, \$2, \$3\), \(\$4, \$5, \$6\)`)
+	mock.ExpectExec(`INSERT INTO books`).
+		WithArgs(int64(1), "foo", dv([]int64{1, 2}), int64(2), "bar", dv([]int64{3})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	res, err := client.AddBooks(ctx, req)
+	assert.Nil(t, err)
+	n, err := res.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the empty batch doesn't query the database.
+	res, err = client.AddBooks(ctx, &AddBooksReq{})
+	assert.Nil(t, err)
+	n, err = res.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_AddBooks_Chunks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	// SQLite binds up to 999 args, so 333 books with 3 columns are inserted at once.
+	req := &AddBooksReq{}
+	for i := 0; i < 400; i++ {
+		req.Books = append(req.Books, &Book{ID: int64(i), Title: "foo"})
+	}
+
+	client := NewStore(db, sal.WithDialect(sal.DialectSQLite), sal.SkipPrepare())
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO books \(id, title, tags\) VALUES (\(\?, \?, \?\), ){332}\(\?, \?, \?\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 333))
+	mock.ExpectExec(`INSERT INTO books \(id, title, tags\) VALUES (\(\?, \?, \?\), ){66}\(\?, \?, \?\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 67))
+	mock.ExpectCommit()
+	res, err := client.AddBooks(ctx, req)
+	assert.Nil(t, err)
+	n, err := res.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(400), n)
+	assert.Len(t, req.Books, 400)
+
+	// the failed chunk rolls back the transaction.
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO books`).WillReturnError(errors.New("failure"))
+	mock.ExpectRollback()
+	_, err = client.AddBooks(ctx, req)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSalStore_AddBooksCount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	client := NewStore(db)
+
+	mock.ExpectPrepare(`VALUES \(\$1, \$2, \$3\) RETURNING id\) SELECT count`)
+	mock.ExpectQuery(`WITH ins AS`).
+		WithArgs(int64(1), "foo", dv(nil)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	resp, err := client.AddBooksCount(ctx, &AddBooksCountReq{Books: []*Book{{ID: 1, Title: "foo"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, &AddBooksCountResp{Count: 1}, resp)
+
+	// the empty batch doesn't query the database.
+	resp, err = client.AddBooksCount(ctx, &AddBooksCountReq{})
+	assert.Equal(t, sal.ErrEmptyBatch, err)
+	assert.Nil(t, resp)
+
+	// the batch of single-row query isn't split, so it can't exceed the limit of args.
+	books := make([]*Book, 65535/3+1)
+	for i := range books {
+		books[i] = &Book{ID: int64(i)}
+	}
+	resp, err = client.AddBooksCount(ctx, &AddBooksCountReq{Books: books})
+	assert.Equal(t, &sal.BatchSizeError{Name: "books", Rows: len(books), Max: 65535 / 3}, err)
+	assert.EqualError(t, err, "sal: batch books of 21846 rows exceeds the limit of 21845 rows of query")
+	assert.Nil(t, resp)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -15,10 +15,11 @@ func NewUserService(store storage.Store) *UserService {
 	return &UserService{store: store}
 }
 
-func (s *UserService) CreateUser(ctx context.Context, name, email string) (*User, error) {
+func (s *UserService) CreateUser(ctx context.Context, name, email, password string) (*User, error) {
 	req := storage.CreateUserReq{
-		Name:  name,
-		Email: email,
+		Name:     name,
+		Email:    email,
+		Password: password,
 	}
 
 	resp, err := s.store.CreateUser(ctx, req)
@@ -27,18 +27,23 @@ func NewStore(h sal.QueryHandler, options ...sal.ClientOption) *SalStore {
 }
 
 func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, error) {
-	dbConn, ok := s.handler.(sal.TransactionBegin)
-	if !ok {
-		return nil, errors.New("handler doesn't satisfy the interface TransactionBegin")
-	}
 	var (
 		err error
-		tx  *sql.Tx
+		tx  sal.SqlTx
 	)
 
 	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Begin")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "BeginTx")
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "BeginTx",
+		Type:      sal.OperationTypeBegin,
+		RawQuery:  "BEGIN",
+		Query:     "BEGIN",
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -48,15 +53,34 @@ func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, err
 		}
 	}
 
-	tx, err = dbConn.BeginTx(ctx, opts)
+	op := &sal.Operation{
+		Method:   "BeginTx",
+		Type:     sal.OperationTypeBegin,
+		Query:    "BEGIN",
+		Response: &tx,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		tx, err = s.ctrl.BeginTx(ctx, s.handler, opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to start tx")
+		}
+		return nil
+	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to start tx")
+		err = s.ctrl.HandleError(ctx, err)
 		return nil, err
 	}
 
+	// the nested transaction keeps the parent of transaction to prepare statements.
+	parent := s.handler
+	if s.txOpened {
+		parent = s.parent
+	}
 	newClient := &SalStore{
 		handler:  tx,
-		parent:   s.handler,
+		parent:   parent,
 		ctrl:     s.ctrl,
 		txOpened: true,
 	}
@@ -70,6 +94,23 @@ func (s *SalStore) Tx() sal.Transaction {
 	}
 	return nil
 }
+
+func (s *SalStore) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	run := func(ctx context.Context) error {
+		client, err := s.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+			return fn(client)
+		})
+	}
+	// the nested transaction can't be retried, the error aborts the whole transaction.
+	if s.txOpened {
+		return run(ctx)
+	}
+	return s.ctrl.Retry(ctx, run)
+}
 func (s *SalStore) AllUsers(ctx context.Context, req AllUsersReq) ([]*AllUsersResp, error) {
 	var (
 		err      error
@@ -81,12 +122,18 @@ func (s *SalStore) AllUsers(ctx context.Context, req AllUsersReq) ([]*AllUsersRe
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Query")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "AllUsers")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "AllUsers",
+		Type:      sal.OperationTypeQuery,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -96,38 +143,61 @@ func (s *SalStore) AllUsers(ctx context.Context, req AllUsersReq) ([]*AllUsersRe
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var list = make([]*AllUsersResp, 0)
+	op := &sal.Operation{
+		Method:   "AllUsers",
+		Type:     sal.OperationTypeQuery,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &list,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
-	}
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	var list = make([]*AllUsersResp, 0)
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
+		}
 
-	for rows.Next() {
-		var resp AllUsersResp
-		var respMap = make(sal.RowMap)
-		respMap.AppendTo("id", &resp.ID)
-		respMap.AppendTo("name", &resp.Name)
-		respMap.AppendTo("email", &resp.Email)
-		respMap.AppendTo("created_at", &resp.CreatedAt)
+		for rows.Next() {
+			var resp AllUsersResp
+			var respMap = make(sal.RowMap)
+			respMap.AppendTo("id", &resp.ID)
+			respMap.AppendTo("name", &resp.Name)
+			respMap.AppendTo("email", &resp.Email)
+			respMap.AppendTo("created_at", &resp.CreatedAt)
 
-		dest := sal.GetDests(cols, respMap)
+			dest := sal.GetDests(cols, respMap)
 
-		if err = rows.Scan(dest...); err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+			if err = rows.Scan(dest...); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
+
+			list = append(list, &resp)
 		}
 
-		list = append(list, &resp)
-	}
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
+
+		s.ctrl.HandleQueryResult(ctx, len(list), list)
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
 	return list, nil
@@ -141,17 +211,25 @@ func (s *SalStore) CreateUser(ctx context.Context, req CreateUserReq) (*CreateUs
 	)
 	reqMap.AppendTo("name", &req.Name)
 	reqMap.AppendTo("email", &req.Email)
+	reqMap.AppendTo("password", &req.Password)
 
 	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "QueryRow")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "CreateUser")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "CreateUser",
+		Type:      sal.OperationTypeQueryRow,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		Secrets:   []string{"password"},
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -161,37 +239,61 @@ func (s *SalStore) CreateUser(ctx context.Context, req CreateUserReq) (*CreateUs
 		}
 	}
 
-	rows, err := stmt.QueryContext(ctx, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute Query")
+	var resp CreateUserResp
+	op := &sal.Operation{
+		Method:   "CreateUser",
+		Type:     sal.OperationTypeQueryRow,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &resp,
+		Handler:  s.handler,
 	}
-	defer rows.Close()
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch columns")
-	}
+		rows, err := stmt.QueryContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Query")
+		}
+		defer rows.Close()
 
-	if !rows.Next() {
-		if err = rows.Err(); err != nil {
-			return nil, errors.Wrap(err, "rows error")
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch columns")
 		}
-		return nil, sql.ErrNoRows
-	}
 
-	var resp CreateUserResp
-	var respMap = make(sal.RowMap)
-	respMap.AppendTo("id", &resp.ID)
-	respMap.AppendTo("created_at", &resp.CreatedAt)
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "rows error")
+			}
+			return sql.ErrNoRows
+		}
 
-	dest := sal.GetDests(cols, respMap)
+		var respMap = make(sal.RowMap)
+		respMap.AppendTo("id", &resp.ID)
+		respMap.AppendTo("created_at", &resp.CreatedAt)
 
-	if err = rows.Scan(dest...); err != nil {
-		return nil, errors.Wrap(err, "failed to scan row")
-	}
+		dest := sal.GetDests(cols, respMap)
+
+		if err = rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "something failed during iteration")
+		}
 
-	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "something failed during iteration")
+		s.ctrl.HandleQueryResult(ctx, 1, &resp)
+
+		return nil
+	})
+	if err != nil {
+		err = s.ctrl.HandleError(ctx, err)
+		return nil, err
 	}
 
 	return &resp, nil
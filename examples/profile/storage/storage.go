@@ -12,12 +12,13 @@ type Store interface {
 }
 
 type CreateUserReq struct {
-	Name  string `sql:"name"`
-	Email string `sql:"email"`
+	Name     string `sql:"name"`
+	Email    string `sql:"email"`
+	Password string `sql:"password,secret"`
 }
 
 func (r CreateUserReq) Query() string {
-	return `INSERT INTO users(name, email, created_at) VALUES(@name, @email, now()) RETURNING id, created_at`
+	return `INSERT INTO users(name, email, password, created_at) VALUES(@name, @email, crypt(@password, gen_salt('bf')), now()) RETURNING id, created_at`
 }
 
 type CreateUserResp struct {
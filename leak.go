@@ -0,0 +1,142 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+// TxLeakDetector detects the transactions that are started by BeginTx of generated clients
+// or Controller.BeginTx but aren't committed or rolled back.
+type TxLeakDetector struct {
+	// Threshold is the duration after which the open transaction is reported.
+	// Zero disables the reporting.
+	Threshold time.Duration
+	// Report is called once for each transaction that is open longer than Threshold.
+	// It's called in a separate goroutine.
+	Report func(leak TxLeak)
+	// RollbackOnCancel enables the rollback of transaction when the context passed to BeginTx is done.
+	// The rollback is executed with WrappedTx, so the statements of transaction are closed
+	// and AfterRollback callbacks are called.
+	RollbackOnCancel bool
+}
+
+// TxLeak describes the transaction that is open longer than the threshold.
+type TxLeak struct {
+	// Method is the method that started the transaction, e.g. "Store.BeginTx".
+	Method string
+	// StartedAt is the time when the transaction started.
+	StartedAt time.Time
+	// Duration is the time the transaction is open.
+	Duration time.Duration
+	// Stack is the stack trace of goroutine that started the transaction.
+	Stack []byte
+}
+
+// DetectTxLeaks enables the detection of transactions that aren't finished.
+//
+//	client := NewStore(db, sal.DetectTxLeaks(sal.TxLeakDetector{
+//		Threshold: time.Minute,
+//		Report: func(leak sal.TxLeak) {
+//			log.Printf("tx %s is open for %v:\n%s", leak.Method, leak.Duration, leak.Stack)
+//		},
+//		RollbackOnCancel: true,
+//	}))
+func DetectTxLeaks(detector TxLeakDetector) ClientOption {
+	return func(ctrl *Controller) { ctrl.leakDetector = &detector }
+}
+
+// afterFunc starts the timer of leak detector, it's replaced in tests to fire the timer without waiting.
+var afterFunc = time.AfterFunc
+
+type openTx struct {
+	timer *time.Timer
+	done  chan struct{}
+}
+
+// trackTx starts to track the transaction until it's finished, see untrackTx.
+// The transaction is tracked if the leak detector is enabled or if it's *sql.Tx started
+// with the context that can be done. database/sql rolls back such transaction when the context
+// is done, so its statements and callbacks are released as if it's rolled back with WrappedTx.
+func (ctrl *Controller) trackTx(ctx context.Context, tx SqlTx) {
+	var (
+		d          = ctrl.leakDetector
+		_, isSQLTx = tx.(*sql.Tx)
+		release    = isSQLTx && ctx.Done() != nil
+		rollback   = d != nil && d.RollbackOnCancel && ctx.Done() != nil
+	)
+	if (d == nil && !release) || !reflect.TypeOf(tx).Comparable() {
+		return
+	}
+
+	otx := &openTx{done: make(chan struct{})}
+	if d != nil && d.Threshold > 0 && d.Report != nil {
+		leak := TxLeak{StartedAt: time.Now(), Stack: debug.Stack()}
+		if info, ok := OperationFromContext(ctx); ok {
+			leak.Method = info.Method
+			if info.Interface != "" {
+				leak.Method = info.Interface + "." + info.Method
+			}
+		}
+		otx.timer = afterFunc(d.Threshold, func() {
+			leak.Duration = time.Since(leak.StartedAt)
+			d.Report(leak)
+		})
+	}
+	ctrl.Lock()
+	if ctrl.openTxs == nil {
+		ctrl.openTxs = make(map[interface{}]*openTx)
+	}
+	ctrl.openTxs[tx] = otx
+	ctrl.Unlock()
+
+	if release || rollback {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-otx.done:
+				return
+			}
+			// the transaction can be finished with WrappedTx concurrently.
+			if !ctrl.untrackTx(tx) {
+				return
+			}
+			if rollback {
+				NewWrappedTx(tx, ctrl).Rollback(context.Background())
+				return
+			}
+			ctrl.finishTx(context.Background(), tx, false)
+		}()
+	}
+}
+
+// untrackTx stops the tracking of transaction that is being finished.
+// It reports whether the transaction was tracked, so only one of the concurrent callers
+// finishes the transaction.
+func (ctrl *Controller) untrackTx(tx interface{}) bool {
+	if !reflect.TypeOf(tx).Comparable() {
+		return false
+	}
+	ctrl.Lock()
+	otx, ok := ctrl.openTxs[tx]
+	delete(ctrl.openTxs, tx)
+	ctrl.Unlock()
+	if !ok {
+		return false
+	}
+	if otx.timer != nil {
+		otx.timer.Stop()
+	}
+	close(otx.done)
+	return true
+}
+
+// OpenTxs returns the number of transactions started by BeginTx that aren't finished yet.
+// Without the leak detector only *sql.Tx started with the context that can be done are tracked.
+func (ctrl *Controller) OpenTxs() int {
+	ctrl.RLock()
+	defer ctrl.RUnlock()
+	return len(ctrl.openTxs)
+}
@@ -0,0 +1,110 @@
+package sal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTimer is the timer of leak detector that is fired by the test.
+type fakeTimer struct {
+	timer *time.Timer
+	fire  func()
+}
+
+// fakeAfterFunc replaces afterFunc with the function that sends the timers to the channel,
+// the returned function restores afterFunc.
+func fakeAfterFunc() (<-chan fakeTimer, func()) {
+	timers := make(chan fakeTimer, 1)
+	afterFunc = func(d time.Duration, f func()) *time.Timer {
+		// the real timer is never fired, it's used only to know whether it's stopped.
+		timer := time.AfterFunc(time.Hour, func() {})
+		timers <- fakeTimer{timer: timer, fire: f}
+		return timer
+	}
+	return timers, func() { afterFunc = time.AfterFunc }
+}
+
+func TestDetectTxLeaks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	timers, restore := fakeAfterFunc()
+	defer restore()
+	var leaks []TxLeak
+	ctrl := NewController(DetectTxLeaks(TxLeakDetector{
+		Threshold: time.Minute,
+		Report:    func(leak TxLeak) { leaks = append(leaks, leak) },
+	}))
+	ctx := WithOperation(context.Background(), &OperationInfo{Interface: "Store", Method: "BeginTx"})
+
+	mock.ExpectBegin()
+	tx, err := ctrl.BeginTx(ctx, db, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ctrl.OpenTxs())
+
+	timer := <-timers
+	timer.fire()
+	if assert.Len(t, leaks, 1) {
+		assert.Equal(t, "Store.BeginTx", leaks[0].Method)
+		assert.False(t, leaks[0].StartedAt.IsZero())
+		assert.Contains(t, string(leaks[0].Stack), "TestDetectTxLeaks")
+	}
+
+	mock.ExpectRollback()
+	assert.NoError(t, NewWrappedTx(tx, ctrl).Rollback(ctx))
+	assert.Equal(t, 0, ctrl.OpenTxs())
+
+	// the timer of finished transaction is stopped, so it isn't reported.
+	mock.ExpectBegin()
+	tx, err = ctrl.BeginTx(ctx, db, nil)
+	assert.NoError(t, err)
+	timer = <-timers
+	mock.ExpectCommit()
+	assert.NoError(t, NewWrappedTx(tx, ctrl).Commit(ctx))
+	assert.False(t, timer.timer.Stop(), "timer of finished transaction isn't stopped")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDetectTxLeaks_RollbackOnCancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctrl := NewController(DetectTxLeaks(TxLeakDetector{RollbackOnCancel: true}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the nested transaction is used, because database/sql rolls back *sql.Tx itself
+	// when its context is done.
+	mock.ExpectBegin()
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	sp, err := ctrl.BeginTx(ctx, tx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ctrl.OpenTxs())
+
+	rolledBack := make(chan struct{})
+	NewWrappedTx(sp, ctrl).AfterRollback(func(ctx context.Context) { close(rolledBack) })
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT " + sp.(*Savepoint).Name()).WillReturnResult(sqlmock.NewResult(0, 0))
+	cancel()
+
+	select {
+	case <-rolledBack:
+	case <-time.After(time.Second):
+		t.Fatal("transaction isn't rolled back")
+	}
+	assert.Equal(t, 0, ctrl.OpenTxs())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
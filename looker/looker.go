@@ -156,11 +156,15 @@ func LookAtFuncParameters(mt reflect.Type) (Parameters, Parameters) {
 
 // Use exported fields because god.Encoder
 type StructElement struct {
-	ImportPath   ImportElement
-	UserType     string
-	IsPointer    bool
-	Fields       Fields
-	ProcessRower bool
+	ImportPath    ImportElement
+	UserType      string
+	IsPointer     bool
+	Fields        Fields
+	ProcessRower  bool
+	NoPreparer    bool
+	PrimaryReader bool
+	ShardKeyer    bool
+	TableNamer    bool
 }
 
 func (prm *StructElement) Kind() string {
@@ -253,6 +257,68 @@ func (prm *InterfaceElement) ImportPaths() []string {
 	return []string{}
 }
 
+// FuncElement represents the parameter of func type, e.g. the callback of streaming method.
+type FuncElement struct {
+	ImportPath ImportElement
+	UserType   string
+	In         Parameters
+	Out        Parameters
+}
+
+func (prm *FuncElement) Kind() string {
+	return reflect.Func.String()
+}
+
+func (prm *FuncElement) Name(dstPath string) string {
+	if prm.UserType != "" {
+		if dstPath == prm.ImportPath.Path {
+			return prm.UserType
+		}
+		return prm.ImportPath.Name() + "." + prm.UserType
+	}
+
+	name := "func(" + paramsNames(prm.In, dstPath) + ")"
+	switch len(prm.Out) {
+	case 0:
+	case 1:
+		name += " " + paramsNames(prm.Out, dstPath)
+	default:
+		name += " (" + paramsNames(prm.Out, dstPath) + ")"
+	}
+	return name
+}
+
+func (prm *FuncElement) Pointer() bool {
+	return false
+}
+
+func (prm *FuncElement) ImportPaths() []string {
+	list := make([]string, 0)
+	if prm.ImportPath.Path != "" {
+		list = append(list, prm.ImportPath.Path)
+	}
+	for _, p := range prm.In {
+		list = append(list, p.ImportPaths()...)
+	}
+	for _, p := range prm.Out {
+		list = append(list, p.ImportPaths()...)
+	}
+	return list
+}
+
+// paramsNames returns the comma separated list of types of parameters.
+func paramsNames(prms Parameters, dstPath string) string {
+	names := make([]string, 0, len(prms))
+	for _, p := range prms {
+		name := p.Name(dstPath)
+		if p.Pointer() {
+			name = "*" + name
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
 type UnsupportedElement struct {
 	ImportPath ImportElement
 	UserType   string
@@ -295,11 +361,15 @@ func LookAtParameter(at reflect.Type) Parameter {
 	switch at.Kind() {
 	case reflect.Struct:
 		prm = &StructElement{
-			ImportPath:   im,
-			UserType:     at.Name(),
-			IsPointer:    pointer,
-			Fields:       LookAtFields(at),
-			ProcessRower: IsProcessRower(reflect.New(at).Interface()),
+			ImportPath:    im,
+			UserType:      at.Name(),
+			IsPointer:     pointer,
+			Fields:        LookAtFields(at),
+			ProcessRower:  IsProcessRower(reflect.New(at).Interface()),
+			NoPreparer:    IsNoPreparer(reflect.New(at).Interface()),
+			PrimaryReader: IsPrimaryReader(reflect.New(at).Interface()),
+			ShardKeyer:    IsShardKeyer(reflect.New(at).Interface()),
+			TableNamer:    IsTableNamer(reflect.New(at).Interface()),
 		}
 	case reflect.Slice:
 		prm = &SliceElement{
@@ -313,6 +383,14 @@ func LookAtParameter(at reflect.Type) Parameter {
 			ImportPath: im,
 			UserType:   at.Name(),
 		}
+	case reflect.Func:
+		in, out := LookAtFuncParameters(at)
+		prm = &FuncElement{
+			ImportPath: im,
+			UserType:   at.Name(),
+			In:         in,
+			Out:        out,
+		}
 	default:
 		prm = &UnsupportedElement{
 			ImportPath: im,
@@ -331,6 +409,30 @@ func IsProcessRower(s interface{}) bool {
 	return ok
 }
 
+func IsNoPreparer(s interface{}) bool {
+	_, ok := s.(sal.NoPreparer)
+
+	return ok
+}
+
+func IsPrimaryReader(s interface{}) bool {
+	_, ok := s.(sal.PrimaryReader)
+
+	return ok
+}
+
+func IsShardKeyer(s interface{}) bool {
+	_, ok := s.(sal.ShardKeyer)
+
+	return ok
+}
+
+func IsTableNamer(s interface{}) bool {
+	_, ok := s.(sal.TableNamer)
+
+	return ok
+}
+
 // Field describes the fields of struct after reflection.
 type Field struct {
 	// See the fields that describe Req struct.
@@ -349,16 +451,25 @@ type Field struct {
 	Anonymous bool
 	// Tag contains the value for tag with name `sql` if it's presented.
 	Tag string
+	// Secret sets to true if the tag contains the option secret, `sql:"password,secret"`.
+	// The values of secret fields are hidden by middlewares, e.g. in logs.
+	Secret bool
+	// Shard sets to true if the tag contains the option shard, `sql:"tenant_id,shard"`.
+	// The value of field is the key of shard of request.
+	Shard bool
+	// Batch describes the item of slice if the tag contains the option batch, `sql:"rows,batch"`.
+	// The slice is expanded to the list of rows in the query, see sal.Batch.
+	Batch *StructElement
 	// todo
 	Parents []string
 }
 
 // ColumnName returns the column name to use for mapping with sql response.
 func (f Field) ColumnName() string {
-	if f.Tag == "" {
-		return f.Name
+	if name, _ := parseTag(f.Tag); name != "" {
+		return name
 	}
-	return f.Tag
+	return f.Name
 }
 
 func (f Field) Path() string {
@@ -372,6 +483,33 @@ type Fields []Field
 // tagName contains the name of tag of struct field to make mapping with sql response.
 const tagName = "sql"
 
+// tagOptionSecret is the option of tag that marks the field as secret.
+const tagOptionSecret = "secret"
+
+// tagOptionShard is the option of tag that marks the field as the key of shard.
+const tagOptionShard = "shard"
+
+// tagOptionBatch is the option of tag that marks the slice of structs as the batch of rows.
+const tagOptionBatch = "batch"
+
+// parseTag splits the value of tag to the column name and the list of options,
+// `sql:"password,secret"` is parsed to the name "password" and options "secret".
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+// hasOption reports whether the option is presented in the value of tag.
+func hasOption(tag string, option string) bool {
+	_, opts := parseTag(tag)
+	for _, opt := range opts {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
 // LookAtFields receives the reflect.Type object of struct and returns the Fields.
 func LookAtFields(st reflect.Type) Fields {
 	fields := make(Fields, 0, st.NumField())
@@ -393,15 +531,23 @@ func LookAtField(ft reflect.StructField) Fields {
 		}
 		return list
 	}
+	tag := ft.Tag.Get(tagName)
 	f := Field{
 		Name:       ft.Name,
 		ImportPath: ImportElement{Path: ft.Type.PkgPath()},
 		BaseType:   ft.Type.Kind().String(),
 		UserType:   ft.Type.Name(),
 		Anonymous:  ft.Anonymous,
-		Tag:        ft.Tag.Get(tagName),
+		Tag:        tag,
+		Secret:     hasOption(tag, tagOptionSecret),
+		Shard:      hasOption(tag, tagOptionShard),
 		Parents:    make([]string, 0),
 	}
+	if hasOption(tag, tagOptionBatch) && ft.Type.Kind() == reflect.Slice {
+		if item, ok := LookAtParameter(ft.Type.Elem()).(*StructElement); ok {
+			f.Batch = item
+		}
+	}
 	return []Field{f}
 }
 
@@ -208,6 +208,59 @@ func TestLookAtFields(t *testing.T) {
 		t.Logf("struct field %# v", pretty.Formatter(actFields))
 	})
 
+	t.Run("tag options", func(t *testing.T) {
+		var typ reflect.Type = reflect.TypeOf(testdata.Req4{})
+		actFields := looker.LookAtFields(typ)
+		expFields := looker.Fields{
+			{
+				Name:       "TenantID",
+				ImportPath: looker.ImportElement{},
+				BaseType:   "int64",
+				UserType:   "int64",
+				Anonymous:  false,
+				Tag:        "tenant_id,shard",
+				Shard:      true,
+				Parents:    []string{},
+			},
+			{
+				Name:       "Login",
+				ImportPath: looker.ImportElement{},
+				BaseType:   "string",
+				UserType:   "string",
+				Anonymous:  false,
+				Tag:        "login",
+				Parents:    []string{},
+			},
+			{
+				Name:       "Password",
+				ImportPath: looker.ImportElement{},
+				BaseType:   "string",
+				UserType:   "string",
+				Anonymous:  false,
+				Tag:        "password,secret",
+				Secret:     true,
+				Parents:    []string{},
+			},
+		}
+		assert.Equal(t, expFields, actFields)
+		assert.Equal(t, "tenant_id", actFields[0].ColumnName())
+		assert.Equal(t, "password", actFields[2].ColumnName())
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var typ reflect.Type = reflect.TypeOf(testdata.Req5{})
+		actFields := looker.LookAtFields(typ)
+		assert.Len(t, actFields, 2)
+		assert.Nil(t, actFields[0].Batch)
+		assert.Equal(t, "rows", actFields[1].ColumnName())
+		assert.Equal(t, &looker.StructElement{
+			ImportPath: looker.ImportElement{Path: "github.com/go-gad/sal/looker/testdata"},
+			UserType:   "Req1",
+			IsPointer:  true,
+			Fields:     looker.LookAtFields(reflect.TypeOf(testdata.Req1{})),
+		}, actFields[1].Batch)
+	})
+
 	t.Run("nested", func(t *testing.T) {
 		var typ reflect.Type = reflect.TypeOf(testdata.Lvl1{})
 		actFields := looker.LookAtFields(typ)
@@ -322,3 +375,25 @@ func TestIsProcessRower(t *testing.T) {
 		assert.Equal(t, tc.exp, looker.IsProcessRower(reflect.New(typ).Interface()), "input typ %q", typ.String())
 	}
 }
+
+func TestIsNoPreparer(t *testing.T) {
+	for _, tc := range []struct {
+		typ reflect.Type
+		exp bool
+	}{
+		{reflect.TypeOf(testdata.Req1{}), false},
+		{reflect.TypeOf(testdata.Req3{}), true},
+		{reflect.TypeOf(&testdata.Req3{}), true},
+	} {
+		var typ reflect.Type = tc.typ
+		if tc.typ.Kind() == reflect.Ptr {
+			typ = tc.typ.Elem()
+		}
+		assert.Equal(t, tc.exp, looker.IsNoPreparer(reflect.New(typ).Interface()), "input typ %q", typ.String())
+	}
+}
+
+func TestIsTableNamer(t *testing.T) {
+	assert.False(t, looker.IsTableNamer(&testdata.Req1{}))
+	assert.True(t, looker.IsTableNamer(&testdata.Item1{}))
+}
@@ -76,6 +76,8 @@ func run(program string) (*Package, error) {
 	gob.Register(&StructElement{})
 	gob.Register(&SliceElement{})
 	gob.Register(&InterfaceElement{})
+	gob.Register(&FuncElement{})
+	gob.Register(&UnsupportedElement{})
 
 	if err := gob.NewDecoder(f).Decode(&pkg); err != nil {
 		return nil, errors.Wrap(err, "failed to decode pkg")
@@ -141,17 +143,16 @@ type reflectData struct {
 	Symbols    []string
 }
 
-func EncodeGob(output string, pkg *Package) error {
+func EncodeGob(output string, pkg *Package) (err error) {
 	outfile := os.Stdout
 
 	if len(output) != 0 {
-		var err error
 		if outfile, err = os.Create(output); err != nil {
 			return fmt.Errorf("failed to open output file %q: %s", output, err)
 		}
 		defer func() {
-			if err := outfile.Close(); err != nil {
-				fmt.Errorf("failed to close output file %q: %s", output, err)
+			if cerr := outfile.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("failed to close output file %q: %s", output, cerr)
 			}
 		}()
 	}
@@ -159,12 +160,14 @@ func EncodeGob(output string, pkg *Package) error {
 	gob.Register(&StructElement{})
 	gob.Register(&SliceElement{})
 	gob.Register(&InterfaceElement{})
+	gob.Register(&FuncElement{})
+	gob.Register(&UnsupportedElement{})
 	//gob.Register(Parameters{})
 	//gob.Register(Field{})
 	//gob.Register(Fields{})
 
 	if err := gob.NewEncoder(outfile).Encode(pkg); err != nil {
-		fmt.Errorf("gob encode: %s", err)
+		return fmt.Errorf("gob encode: %s", err)
 	}
 
 	return nil
@@ -28,18 +28,23 @@ func NewStore(h sal.QueryHandler, options ...sal.ClientOption) *SalStore {
 }
 
 func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, error) {
-	dbConn, ok := s.handler.(sal.TransactionBegin)
-	if !ok {
-		return nil, errors.New("handler doesn't satisfy the interface TransactionBegin")
-	}
 	var (
 		err error
-		tx  *sql.Tx
+		tx  sal.SqlTx
 	)
 
 	ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Begin")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "BeginTx")
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "BeginTx",
+		Type:      sal.OperationTypeBegin,
+		RawQuery:  "BEGIN",
+		Query:     "BEGIN",
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -49,15 +54,34 @@ func (s *SalStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (Store, err
 		}
 	}
 
-	tx, err = dbConn.BeginTx(ctx, opts)
+	op := &sal.Operation{
+		Method:   "BeginTx",
+		Type:     sal.OperationTypeBegin,
+		Query:    "BEGIN",
+		Response: &tx,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		tx, err = s.ctrl.BeginTx(ctx, s.handler, opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to start tx")
+		}
+		return nil
+	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to start tx")
+		err = s.ctrl.HandleError(ctx, err)
 		return nil, err
 	}
 
+	// the nested transaction keeps the parent of transaction to prepare statements.
+	parent := s.handler
+	if s.txOpened {
+		parent = s.parent
+	}
 	newClient := &SalStore{
 		handler:  tx,
-		parent:   s.handler,
+		parent:   parent,
 		ctrl:     s.ctrl,
 		txOpened: true,
 	}
@@ -71,6 +95,23 @@ func (s *SalStore) Tx() sal.Transaction {
 	}
 	return nil
 }
+
+func (s *SalStore) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	run := func(ctx context.Context) error {
+		client, err := s.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return sal.RunTx(ctx, client.(*SalStore).Tx(), func() error {
+			return fn(client)
+		})
+	}
+	// the nested transaction can't be retried, the error aborts the whole transaction.
+	if s.txOpened {
+		return run(ctx)
+	}
+	return s.ctrl.Retry(ctx, run)
+}
 func (s *SalStore) UpdateAuthor(ctx context.Context, req *foo.Body) error {
 	var (
 		err      error
@@ -82,12 +123,18 @@ func (s *SalStore) UpdateAuthor(ctx context.Context, req *foo.Body) error {
 	ctx = context.WithValue(ctx, sal.ContextKeyOperationType, "Exec")
 	ctx = context.WithValue(ctx, sal.ContextKeyMethodName, "UpdateAuthor")
 
-	pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)
-
-	stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)
+	ctx = sal.WithOperation(ctx, &sal.OperationInfo{
+		Interface: "Store",
+		Method:    "UpdateAuthor",
+		Type:      sal.OperationTypeExec,
+		RawQuery:  rawQuery,
+		Query:     query,
+		Args:      args,
+		ArgNames:  names,
+		TxOpened:  s.txOpened,
+		Tx:        s.Tx(),
+	})
 
 	for _, fn := range s.ctrl.BeforeQuery {
 		var fnz sal.FinalizerFunc
@@ -97,9 +144,35 @@ func (s *SalStore) UpdateAuthor(ctx context.Context, req *foo.Body) error {
 		}
 	}
 
-	_, err = stmt.ExecContext(ctx, args...)
+	var res sql.Result
+	op := &sal.Operation{
+		Method:   "UpdateAuthor",
+		Type:     sal.OperationTypeExec,
+		Query:    query,
+		Args:     args,
+		Request:  req,
+		Response: &res,
+		Handler:  s.handler,
+	}
+	err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {
+		var err error
+		stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		res, err = stmt.ExecContext(ctx, op.Args...)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute Exec")
+		}
+
+		s.ctrl.HandleExecResult(ctx, res)
+
+		return nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to execute Exec")
+		err = s.ctrl.HandleError(ctx, err)
+		return err
 	}
 
 	return nil
@@ -22,6 +22,29 @@ type Req2 struct {
 
 func (r *Req2) ProcessRow(rm sal.RowMap) {}
 
+type Req3 struct {
+	ID int64 `sql:"id"`
+}
+
+func (r *Req3) NoPrepare() {}
+
+type Req4 struct {
+	TenantID int64  `sql:"tenant_id,shard"`
+	Login    string `sql:"login"`
+	Password string `sql:"password,secret"`
+}
+
+type Req5 struct {
+	ShelfID int64   `sql:"shelf_id"`
+	Rows    []*Req1 `sql:"rows,batch"`
+}
+
+type Item1 struct {
+	ID int64 `sql:"id"`
+}
+
+func (i *Item1) TableName() string { return "items" }
+
 type Lvl1 struct {
 	Name string
 	Desc string
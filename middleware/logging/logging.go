@@ -0,0 +1,138 @@
+// Package logging provides the hook that logs the operations of sal clients.
+//
+//	logger := logging.PrintfLogger(log.New(os.Stderr, "", log.LstdFlags))
+//	client := storage.NewStore(db, sal.BeforeQuery(logging.New(logger, logging.LogArgs())))
+package logging
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gad/sal"
+)
+
+// Redacted is logged instead of the value of secret arg, `sql:"password,secret"`.
+const Redacted = "[REDACTED]"
+
+// Entry describes the completed operation.
+type Entry struct {
+	// Interface is the name of user interface, e.g. "Store".
+	Interface string
+	// Method is the method name, e.g. "GetAuthors".
+	Method string
+	// Operation is the type of operation.
+	Operation sal.OperationType
+	// Query is the query that is sent to the database.
+	Query string
+	// Args are the values of args. They are presented only if the option LogArgs is set.
+	// The values of secret args are replaced with Redacted.
+	Args []interface{}
+	// TxOpened reports whether the operation is executed in the transaction.
+	TxOpened bool
+	// Duration is the time taken by the operation.
+	Duration time.Duration
+	// Err is the error of operation.
+	Err error
+}
+
+// String returns the entry as the line of key=value pairs.
+func (e Entry) String() string {
+	var b strings.Builder
+	b.WriteString("method=")
+	if e.Interface != "" {
+		b.WriteString(e.Interface + ".")
+	}
+	b.WriteString(e.Method)
+	fmt.Fprintf(&b, " operation=%s tx=%t duration=%s query=%s", e.Operation, e.TxOpened, e.Duration, strconv.Quote(e.Query))
+	if e.Args != nil {
+		fmt.Fprintf(&b, " args=%v", e.Args)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, " error=%s", strconv.Quote(e.Err.Error()))
+	}
+
+	return b.String()
+}
+
+// Logger writes the entries of log.
+type Logger interface {
+	Log(ctx context.Context, e Entry)
+}
+
+// LoggerFunc is an adapter to use the ordinary function as Logger.
+type LoggerFunc func(ctx context.Context, e Entry)
+
+// Log calls f(ctx, e).
+func (f LoggerFunc) Log(ctx context.Context, e Entry) {
+	f(ctx, e)
+}
+
+// Printer is the interface of printf-like loggers, it's satisfied by *log.Logger.
+type Printer interface {
+	Printf(format string, v ...interface{})
+}
+
+// PrintfLogger returns the Logger that prints the entries with p.
+func PrintfLogger(p Printer) Logger {
+	return LoggerFunc(func(ctx context.Context, e Entry) {
+		p.Printf("%s", e)
+	})
+}
+
+type config struct {
+	args bool
+}
+
+// Option sets the optional parameters of the hook.
+type Option func(cfg *config)
+
+// LogArgs enables the logging of values of args. The secret args are redacted.
+func LogArgs() Option {
+	return func(cfg *config) { cfg.args = true }
+}
+
+// New returns the BeforeQuery hook that logs the operation after its completion.
+// The details of operation are taken from sal.OperationFromContext.
+func New(logger Logger, opts ...Option) sal.BeforeQueryFunc {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(ctx context.Context, query string, req interface{}) (context.Context, sal.FinalizerFunc) {
+		start := time.Now()
+		return ctx, func(ctx context.Context, err error) {
+			e := Entry{Query: query, Duration: time.Since(start), Err: err}
+			if info, ok := sal.OperationFromContext(ctx); ok {
+				e.Interface, e.Method, e.Operation, e.TxOpened = info.Interface, info.Method, info.Type, info.TxOpened
+				if info.Query != "" {
+					e.Query = info.Query
+				}
+				if cfg.args {
+					e.Args = redactArgs(info)
+				}
+			}
+			logger.Log(ctx, e)
+		}
+	}
+}
+
+// redactArgs returns the values of args of operation with secret values replaced with Redacted.
+func redactArgs(info *sal.OperationInfo) []interface{} {
+	args := make([]interface{}, len(info.Args))
+	for i, arg := range info.Args {
+		if info.IsSecret(i) {
+			args[i] = Redacted
+			continue
+		}
+		// generated code binds the pointers to fields of request.
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Ptr && !v.IsNil() {
+			arg = v.Elem().Interface()
+		}
+		args[i] = arg
+	}
+	return args
+}
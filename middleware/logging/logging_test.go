@@ -0,0 +1,96 @@
+package logging_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/go-gad/sal"
+	"github.com/go-gad/sal/examples/profile/storage"
+	"github.com/go-gad/sal/middleware/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var entries []logging.Entry
+	logger := logging.LoggerFunc(func(ctx context.Context, e logging.Entry) {
+		entries = append(entries, e)
+	})
+	client := storage.NewStore(db, sal.BeforeQuery(logging.New(logger, logging.LogArgs())))
+	ctx := context.Background()
+
+	req := storage.CreateUserReq{Name: "foo", Email: "foo@example.com", Password: "qwerty"}
+	mock.ExpectPrepare("INSERT INTO users")
+	mock.ExpectQuery("INSERT INTO users").WithArgs(req.Name, req.Email, req.Password).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	_, err = client.CreateUser(ctx, req)
+	assert.Nil(t, err)
+
+	if assert.Len(t, entries, 2) {
+		prepare, e := entries[0], entries[1]
+		assert.Equal(t, sal.OperationTypePrepare, prepare.Operation)
+		assert.Equal(t, "CreateUser", prepare.Method)
+
+		assert.Equal(t, "Store", e.Interface)
+		assert.Equal(t, "CreateUser", e.Method)
+		assert.Equal(t, sal.OperationTypeQueryRow, e.Operation)
+		assert.Equal(t, []interface{}{"foo", "foo@example.com", logging.Redacted}, e.Args)
+		assert.False(t, e.TxOpened)
+		assert.Nil(t, e.Err)
+		assert.NotContains(t, e.String(), "qwerty")
+	}
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestNew_WithoutArgs(t *testing.T) {
+	var entry logging.Entry
+	hook := logging.New(logging.LoggerFunc(func(ctx context.Context, e logging.Entry) { entry = e }))
+	ctx := sal.WithOperation(context.Background(), &sal.OperationInfo{
+		Method: "ExecContext",
+		Type:   sal.OperationTypeExec,
+		Query:  "DELETE FROM users WHERE id=$1",
+		Args:   []interface{}{1},
+	})
+	ctx, fnz := hook(ctx, "DELETE FROM users WHERE id=$1", nil)
+	fnz(ctx, errors.New("failed"))
+
+	assert.Nil(t, entry.Args)
+	assert.EqualError(t, entry.Err, "failed")
+	assert.Equal(t, sal.OperationTypeExec, entry.Operation)
+}
+
+func TestEntry_String(t *testing.T) {
+	e := logging.Entry{
+		Interface: "Store",
+		Method:    "CreateUser",
+		Operation: sal.OperationTypeQueryRow,
+		Query:     "SELECT $1",
+		Args:      []interface{}{1, logging.Redacted},
+		Duration:  time.Millisecond,
+		Err:       errors.New("failed"),
+	}
+	exp := `method=Store.CreateUser operation=QueryRow tx=false duration=1ms query="SELECT $1" args=[1 [REDACTED]] error="failed"`
+	assert.Equal(t, exp, e.String())
+}
+
+type printer []string
+
+func (p *printer) Printf(format string, v ...interface{}) {
+	*p = append(*p, format)
+}
+
+func TestPrintfLogger(t *testing.T) {
+	var p printer
+	logging.PrintfLogger(&p).Log(context.Background(), logging.Entry{})
+	assert.Equal(t, printer{"%s"}, p)
+}
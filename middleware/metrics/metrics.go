@@ -0,0 +1,279 @@
+// Package metrics provides the registry of metrics of sal clients that is exposed
+// in Prometheus text format.
+//
+//	registry := metrics.NewRegistry()
+//	client := NewStore(db, registry.Instrument("store"))
+//	http.Handle("/metrics", registry)
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gad/sal"
+)
+
+// DefaultBuckets are the upper bounds in seconds of buckets of the histogram of durations.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// ContentType is the content type of Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type operationKey struct {
+	intf      string
+	method    string
+	operation string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type client struct {
+	name string
+	ctrl *sal.Controller
+}
+
+// Registry collects the metrics of operations and statement caches of sal clients.
+// It's safe for concurrent use.
+type Registry struct {
+	mu        sync.Mutex
+	buckets   []float64
+	durations map[operationKey]*histogram
+	calls     map[string]uint64
+	errors    map[operationKey]uint64
+	clients   []client
+}
+
+// Option sets the optional parameters of Registry.
+type Option func(r *Registry)
+
+// Buckets sets the upper bounds in seconds of buckets of the histogram of durations.
+func Buckets(buckets ...float64) Option {
+	return func(r *Registry) {
+		r.buckets = append([]float64(nil), buckets...)
+		sort.Float64s(r.buckets)
+	}
+}
+
+// NewRegistry returns the empty registry.
+func NewRegistry(opts ...Option) *Registry {
+	r := &Registry{
+		buckets:   DefaultBuckets,
+		durations: make(map[operationKey]*histogram),
+		calls:     make(map[string]uint64),
+		errors:    make(map[operationKey]uint64),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Hook returns the BeforeQuery hook that collects the metrics of operations.
+func (r *Registry) Hook() sal.BeforeQueryFunc {
+	return func(ctx context.Context, query string, req interface{}) (context.Context, sal.FinalizerFunc) {
+		start := time.Now()
+		return ctx, func(ctx context.Context, err error) {
+			var key operationKey
+			if info, ok := sal.OperationFromContext(ctx); ok {
+				key = operationKey{intf: info.Interface, method: info.Method, operation: info.Type.String()}
+			} else {
+				key.method, _ = ctx.Value(sal.ContextKeyMethodName).(string)
+				key.operation, _ = ctx.Value(sal.ContextKeyOperationType).(string)
+			}
+			r.observe(key, time.Since(start), err)
+		}
+	}
+}
+
+// Instrument returns the option of client that adds the Hook and registers the statement caches
+// of client's controller, including the caches of shards and replicas.
+// The name is used as the value of label client of cache metrics.
+func (r *Registry) Instrument(name string) sal.ClientOption {
+	hook := r.Hook()
+	return func(ctrl *sal.Controller) {
+		ctrl.BeforeQuery = append(ctrl.BeforeQuery, hook)
+		r.mu.Lock()
+		// the cache of statements is created after the options are applied,
+		// so the controller is kept to read it on collecting.
+		r.clients = append(r.clients, client{name: name, ctrl: ctrl})
+		r.mu.Unlock()
+	}
+}
+
+func (r *Registry) observe(key operationKey, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.durations[key] = h
+	}
+	sec := d.Seconds()
+	for i, bound := range r.buckets {
+		if sec <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += sec
+	h.count++
+
+	r.calls[key.operation]++
+	if err != nil {
+		r.errors[key]++
+	}
+}
+
+// WriteTo writes the metrics in Prometheus text format to w.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	r.mu.Lock()
+	r.writeDurations(&b)
+	r.writeCalls(&b)
+	r.writeErrors(&b)
+	clients := append([]client(nil), r.clients...)
+	r.mu.Unlock()
+	writeCaches(&b, clients)
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP writes the metrics in Prometheus text format to response.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+func (r *Registry) writeDurations(b *bytes.Buffer) {
+	const name = "sal_operation_duration_seconds"
+	header(b, name, "histogram", "Duration of operations of sal clients.")
+	for _, key := range sortedKeys(r.durations) {
+		h := r.durations[key]
+		for i, bound := range r.buckets {
+			sample(b, name+"_bucket", operationLabels(key, "le", formatFloat(bound)), float64(h.counts[i]))
+		}
+		sample(b, name+"_bucket", operationLabels(key, "le", "+Inf"), float64(h.count))
+		sample(b, name+"_sum", operationLabels(key), h.sum)
+		sample(b, name+"_count", operationLabels(key), float64(h.count))
+	}
+}
+
+func (r *Registry) writeCalls(b *bytes.Buffer) {
+	const name = "sal_operations_total"
+	header(b, name, "counter", "Number of operations of sal clients by type.")
+	ops := make([]string, 0, len(r.calls))
+	for op := range r.calls {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		sample(b, name, labels("operation", op), float64(r.calls[op]))
+	}
+}
+
+func (r *Registry) writeErrors(b *bytes.Buffer) {
+	const name = "sal_operation_errors_total"
+	header(b, name, "counter", "Number of failed operations of sal clients.")
+	keys := make([]operationKey, 0, len(r.errors))
+	for key := range r.errors {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	for _, key := range keys {
+		sample(b, name, operationLabels(key), float64(r.errors[key]))
+	}
+}
+
+func writeCaches(b *bytes.Buffer, clients []client) {
+	stats := make([]sal.StmtCacheStats, len(clients))
+	for i, c := range clients {
+		stats[i] = c.ctrl.StmtCacheStats()
+	}
+	gauges := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(s sal.StmtCacheStats) float64
+	}{
+		{"sal_stmt_cache_size", "gauge", "Number of prepared statements in the cache.", func(s sal.StmtCacheStats) float64 { return float64(s.Size) }},
+		{"sal_stmt_cache_hits_total", "counter", "Number of lookups that found the prepared statement.", func(s sal.StmtCacheStats) float64 { return float64(s.Hits) }},
+		{"sal_stmt_cache_misses_total", "counter", "Number of lookups that didn't find the prepared statement.", func(s sal.StmtCacheStats) float64 { return float64(s.Misses) }},
+		{"sal_stmt_cache_evictions_total", "counter", "Number of prepared statements evicted from the cache.", func(s sal.StmtCacheStats) float64 { return float64(s.Evictions) }},
+		{"sal_stmt_cache_hit_ratio", "gauge", "Ratio of lookups that found the prepared statement.", hitRatio},
+	}
+	for _, g := range gauges {
+		header(b, g.name, g.typ, g.help)
+		for i, c := range clients {
+			sample(b, g.name, labels("client", c.name), g.value(stats[i]))
+		}
+	}
+}
+
+func hitRatio(s sal.StmtCacheStats) float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func sortedKeys(m map[operationKey]*histogram) []operationKey {
+	keys := make([]operationKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+func sortKeys(keys []operationKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.intf != b.intf {
+			return a.intf < b.intf
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.operation < b.operation
+	})
+}
+
+func header(b *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(b *bytes.Buffer, name string, labels string, value float64) {
+	fmt.Fprintf(b, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+func operationLabels(key operationKey, extra ...string) string {
+	return labels(append([]string{"interface", key.intf, "method", key.method, "operation", key.operation}, extra...)...)
+}
+
+// labels formats the pairs of names and values of labels.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+escaper.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escaper escapes the value of label as it's required by the text format.
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
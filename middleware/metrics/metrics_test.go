@@ -0,0 +1,83 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/go-gad/sal"
+	"github.com/go-gad/sal/examples/bookstore"
+	"github.com/go-gad/sal/middleware/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	registry := metrics.NewRegistry(metrics.Buckets(1, 0.5))
+	client := bookstore.NewStore(db, registry.Instrument("bookstore"))
+	ctx := context.Background()
+
+	mock.ExpectPrepare(`SELECT \* FROM books`)
+	mock.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "foo"))
+	mock.ExpectQuery(`SELECT \* FROM books`).WillReturnError(errors.New("conn reset"))
+	_, err = client.GetBooks(ctx, bookstore.GetBooksReq{})
+	assert.Nil(t, err)
+	_, err = client.GetBooks(ctx, bookstore.GetBooksReq{})
+	assert.NotNil(t, err)
+
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %+v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+
+	text := string(body)
+	for _, line := range []string{
+		"# TYPE sal_operation_duration_seconds histogram",
+		`sal_operation_duration_seconds_bucket{interface="Store",method="GetBooks",operation="Query",le="0.5"} 2`,
+		`sal_operation_duration_seconds_bucket{interface="Store",method="GetBooks",operation="Query",le="+Inf"} 2`,
+		`sal_operation_duration_seconds_count{interface="Store",method="GetBooks",operation="Query"} 2`,
+		`sal_operation_duration_seconds_count{interface="Store",method="GetBooks",operation="Prepare"} 1`,
+		`sal_operations_total{operation="Query"} 2`,
+		`sal_operations_total{operation="Prepare"} 1`,
+		`sal_operation_errors_total{interface="Store",method="GetBooks",operation="Query"} 1`,
+		`sal_stmt_cache_size{client="bookstore"} 1`,
+		`sal_stmt_cache_hits_total{client="bookstore"} 1`,
+		`sal_stmt_cache_misses_total{client="bookstore"} 1`,
+		`sal_stmt_cache_hit_ratio{client="bookstore"} 0.5`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+	assert.True(t, strings.Index(text, `le="0.5"`) < strings.Index(text, `le="1"`), "buckets should be sorted")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRegistry_Hook(t *testing.T) {
+	registry := metrics.NewRegistry()
+	hook := registry.Hook()
+	ctx := sal.WithOperation(context.Background(), &sal.OperationInfo{Method: "Commit", Type: sal.OperationTypeCommit})
+	ctx, fnz := hook(ctx, "COMMIT", nil)
+	fnz(ctx, nil)
+
+	var b strings.Builder
+	_, err := registry.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), `sal_operations_total{operation="Commit"} 1`)
+	assert.NotContains(t, b.String(), "sal_stmt_cache_size{")
+}
@@ -0,0 +1,163 @@
+// Package slowquery provides the interceptor that detects the operations
+// that take longer than the threshold and optionally captures the query plan.
+//
+//	report := func(ctx context.Context, r slowquery.Report) {
+//		log.Printf("slow %s.%s took %v, plan: %s", r.Interface, r.Method, r.Duration, r.Plan)
+//	}
+//	client := NewStore(db, sal.Intercept(slowquery.New(100*time.Millisecond, report, slowquery.Explain())))
+package slowquery
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-gad/sal"
+	"github.com/pkg/errors"
+)
+
+// DefaultExplainPrefix is the prefix that is added to the query to get the plan in PostgreSQL.
+const DefaultExplainPrefix = "EXPLAIN (FORMAT JSON) "
+
+// Report describes the slow operation.
+type Report struct {
+	// Interface is the name of user interface, e.g. "Store".
+	Interface string
+	// Method is the method name, e.g. "GetAuthors".
+	Method string
+	// Type is the type of operation.
+	Type sal.OperationType
+	// Query is the query that is sent to the database.
+	Query string
+	// TxOpened reports whether the operation is executed in the transaction.
+	TxOpened bool
+	// Duration is the time taken by the operation.
+	Duration time.Duration
+	// Threshold is the threshold that was exceeded.
+	Threshold time.Duration
+	// Err is the error of operation.
+	Err error
+	// Plan is the plan of query returned by EXPLAIN. It's empty if the capture of plan is disabled
+	// or the operation failed.
+	Plan string
+	// ExplainErr is the error of EXPLAIN.
+	ExplainErr error
+}
+
+// ReportFunc receives the reports of slow operations.
+type ReportFunc func(ctx context.Context, r Report)
+
+type detector struct {
+	threshold     time.Duration
+	methods       map[string]time.Duration
+	explain       bool
+	explainPrefix string
+	report        ReportFunc
+}
+
+// Option sets the optional parameters of the detector.
+type Option func(d *detector)
+
+// MethodThreshold sets the threshold for the method of user interface, e.g. "GetAuthors".
+// The zero or negative threshold disables the detection for the method.
+func MethodThreshold(method string, threshold time.Duration) Option {
+	return func(d *detector) { d.methods[method] = threshold }
+}
+
+// Explain enables the capture of plan of slow query with DefaultExplainPrefix.
+func Explain() Option {
+	return ExplainPrefix(DefaultExplainPrefix)
+}
+
+// ExplainPrefix enables the capture of plan of slow query with the prefix
+// that is specific for the database, e.g. "EXPLAIN FORMAT=JSON " for MySQL.
+func ExplainPrefix(prefix string) Option {
+	return func(d *detector) {
+		d.explain = true
+		d.explainPrefix = prefix
+	}
+}
+
+// New returns the interceptor that reports the operations that take longer than threshold.
+//
+// If the capture of plan is enabled then the query is explained with the same args through
+// the handler of operation, so the plan is captured in the same transaction.
+// The plan is captured only for successful Query, QueryRow and Exec operations,
+// because the failed query can abort the transaction.
+func New(threshold time.Duration, report ReportFunc, opts ...Option) sal.Interceptor {
+	d := &detector{
+		threshold: threshold,
+		methods:   make(map[string]time.Duration),
+		report:    report,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d.intercept
+}
+
+func (d *detector) intercept(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+	start := time.Now()
+	err := next(ctx, op)
+	duration := time.Since(start)
+
+	threshold := d.threshold
+	if t, ok := d.methods[op.Method]; ok {
+		threshold = t
+	}
+	if threshold <= 0 || duration < threshold {
+		return err
+	}
+
+	r := Report{
+		Method:    op.Method,
+		Type:      op.Type,
+		Query:     op.Query,
+		Duration:  duration,
+		Threshold: threshold,
+		Err:       err,
+	}
+	if info, ok := sal.OperationFromContext(ctx); ok {
+		r.Interface, r.TxOpened = info.Interface, info.TxOpened
+	}
+	if d.explain && err == nil && isExplainable(op.Type) {
+		r.Plan, r.ExplainErr = d.explainQuery(ctx, op)
+	}
+	d.report(ctx, r)
+
+	return err
+}
+
+// explainQuery returns the plan of query. The lines of plan are joined with new line.
+func (d *detector) explainQuery(ctx context.Context, op *sal.Operation) (string, error) {
+	if op.Handler == nil {
+		return "", errors.New("operation has no handler to explain the query")
+	}
+	rows, err := op.Handler.QueryContext(ctx, d.explainPrefix+op.Query, op.Args...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to explain query")
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err = rows.Scan(&line); err != nil {
+			return "", errors.Wrap(err, "failed to scan plan")
+		}
+		lines = append(lines, line)
+	}
+	if err = rows.Err(); err != nil {
+		return "", errors.Wrap(err, "failed to fetch plan")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func isExplainable(typ sal.OperationType) bool {
+	switch typ {
+	case sal.OperationTypeQuery, sal.OperationTypeQueryRow, sal.OperationTypeExec:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package slowquery_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/go-gad/sal"
+	"github.com/go-gad/sal/examples/bookstore"
+	"github.com/go-gad/sal/middleware/slowquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var reports []slowquery.Report
+	report := func(ctx context.Context, r slowquery.Report) {
+		reports = append(reports, r)
+	}
+	client := bookstore.NewStore(db, sal.Intercept(slowquery.New(10*time.Millisecond, report,
+		slowquery.Explain(),
+		slowquery.MethodThreshold("UpdateAuthor", 0),
+	)))
+	ctx := context.Background()
+
+	plan := `[{"Plan": {"Node Type": "Seq Scan"}}]`
+	mock.ExpectPrepare(`SELECT \* FROM books`)
+	mock.ExpectQuery(`SELECT \* FROM books`).WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "foo"))
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT \* FROM books`).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(plan))
+	_, err = client.GetBooks(ctx, bookstore.GetBooksReq{})
+	assert.Nil(t, err)
+
+	req := bookstore.UpdateAuthorReq{ID: 123, BaseAuthor: bookstore.BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).
+		WillDelayFor(20 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, client.UpdateAuthor(ctx, &req))
+
+	if assert.Len(t, reports, 1) {
+		r := reports[0]
+		assert.Equal(t, "Store", r.Interface)
+		assert.Equal(t, "GetBooks", r.Method)
+		assert.Equal(t, sal.OperationTypeQuery, r.Type)
+		assert.Equal(t, 10*time.Millisecond, r.Threshold)
+		assert.True(t, r.Duration >= 20*time.Millisecond)
+		assert.Equal(t, plan, r.Plan)
+		assert.Nil(t, r.ExplainErr)
+	}
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestNew_Fast(t *testing.T) {
+	var reported bool
+	interceptor := slowquery.New(time.Second, func(ctx context.Context, r slowquery.Report) { reported = true }, slowquery.Explain())
+	err := interceptor(context.Background(), &sal.Operation{Type: sal.OperationTypeQuery}, func(ctx context.Context, op *sal.Operation) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.False(t, reported)
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// RecordedSpan is the span that is recorded by Recorder.
+type RecordedSpan struct {
+	// ID is the identifier of span, starting with 1.
+	ID int
+	// ParentID is the identifier of parent span, it's zero for the root span.
+	ParentID int
+	// Name is the name of span.
+	Name string
+	// Attributes are the attributes of span.
+	Attributes map[string]interface{}
+	// Errors are the recorded errors.
+	Errors []error
+}
+
+// Recorder is the in-memory Tracer that keeps the ended spans. It's useful in tests.
+type Recorder struct {
+	mu     sync.Mutex
+	lastID int
+	spans  []RecordedSpan
+}
+
+type recorderKey struct{}
+
+type recordedSpan struct {
+	recorder *Recorder
+	span     RecordedSpan
+	mu       sync.Mutex
+	ended    bool
+}
+
+// NewRecorder returns the empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start starts the span as the child of the span in ctx that is started by the recorder.
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	r.mu.Lock()
+	r.lastID++
+	id := r.lastID
+	r.mu.Unlock()
+
+	s := &recordedSpan{
+		recorder: r,
+		span:     RecordedSpan{ID: id, Name: name, Attributes: make(map[string]interface{})},
+	}
+	if parent, ok := ctx.Value(recorderKey{}).(*recordedSpan); ok && parent.recorder == r {
+		s.span.ParentID = parent.span.ID
+	}
+	s.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, recorderKey{}, s), s
+}
+
+// Spans returns the ended spans in order of ending.
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Reset removes the recorded spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	for _, attr := range attrs {
+		s.span.Attributes[attr.Key] = attr.Value
+	}
+	s.mu.Unlock()
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	s.span.Errors = append(s.span.Errors, err)
+	s.mu.Unlock()
+}
+
+func (s *recordedSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	span := s.span
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	s.recorder.spans = append(s.recorder.spans, span)
+	s.recorder.mu.Unlock()
+}
@@ -0,0 +1,193 @@
+// Package tracing provides the interceptor that starts the span for each operation of sal client.
+//
+// The package doesn't depend on the particular tracing library. The Tracer and Span interfaces
+// follow the API of OpenTelemetry, so the adapter for the OpenTelemetry tracer is trivial.
+//
+//	client := NewStore(db, tracing.Instrument(tracer))
+//
+// The operations executed in the transaction are the children of the span of transaction,
+// that is started by BeginTx and ended by Commit or Rollback.
+package tracing
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/go-gad/sal"
+)
+
+// Names of attributes of spans.
+const (
+	// AttrSystem is the name of database system, e.g. "postgresql".
+	AttrSystem = "db.system"
+	// AttrStatement is the query that is sent to the database.
+	AttrStatement = "db.statement"
+	// AttrOperation is the type of operation, e.g. "Query".
+	AttrOperation = "db.operation"
+	// AttrTxOpened reports whether the operation is executed in the transaction.
+	AttrTxOpened = "sal.tx_opened"
+)
+
+// TxSpanName is the name of span of transaction.
+const TxSpanName = "Transaction"
+
+// Attribute is the key-value pair that describes the span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is the span of operation.
+type Span interface {
+	// SetAttributes sets the attributes of span.
+	SetAttributes(attrs ...Attribute)
+	// RecordError records the error of operation.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// Tracer starts the spans.
+type Tracer interface {
+	// Start starts the span as the child of the span in ctx and returns ctx with the started span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// systems maps the names of sal dialects to the names of database systems.
+var systems = map[string]string{
+	"postgres":  "postgresql",
+	"mysql":     "mysql",
+	"sqlite":    "sqlite",
+	"sqlserver": "mssql",
+	"oracle":    "oracle",
+}
+
+type txSpan struct {
+	ctx  context.Context
+	span Span
+}
+
+type interceptor struct {
+	tracer Tracer
+	ctrl   *sal.Controller
+	mu     sync.Mutex
+	txs    map[interface{}]txSpan
+}
+
+// Instrument returns the option of client that adds the tracing interceptor.
+// The database system is defined by the dialect of client's controller.
+func Instrument(tracer Tracer) sal.ClientOption {
+	return func(ctrl *sal.Controller) {
+		i := &interceptor{
+			tracer: tracer,
+			ctrl:   ctrl,
+			txs:    make(map[interface{}]txSpan),
+		}
+		ctrl.Interceptors = append(ctrl.Interceptors, i.intercept)
+	}
+}
+
+func (i *interceptor) intercept(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+	var (
+		name     = op.Method
+		txOpened bool
+	)
+	if info, ok := sal.OperationFromContext(ctx); ok {
+		if info.Interface != "" {
+			name = info.Interface + "." + op.Method
+		}
+		txOpened = info.TxOpened
+	}
+
+	var (
+		parent = ctx
+		tx     Span
+	)
+	if op.Type == sal.OperationTypeBegin {
+		parent, tx = i.tracer.Start(ctx, TxSpanName, Attribute{Key: AttrSystem, Value: i.system()})
+	} else if t, ok := i.txSpan(op.Handler); ok {
+		parent = t.ctx
+	}
+
+	spanCtx, span := i.tracer.Start(parent, name,
+		Attribute{Key: AttrSystem, Value: i.system()},
+		Attribute{Key: AttrStatement, Value: op.Query},
+		Attribute{Key: AttrOperation, Value: op.Type.String()},
+		Attribute{Key: AttrTxOpened, Value: txOpened},
+	)
+	err := next(spanCtx, op)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+
+	switch op.Type {
+	case sal.OperationTypeBegin:
+		i.beginTx(parent, tx, op, err)
+	case sal.OperationTypeCommit, sal.OperationTypeRollback:
+		i.endTx(op.Handler, err)
+	}
+
+	return err
+}
+
+// system returns the name of database system of the client.
+func (i *interceptor) system() string {
+	if i.ctrl.Dialect == nil {
+		return systems["postgres"]
+	}
+	if s, ok := systems[i.ctrl.Dialect.Name()]; ok {
+		return s
+	}
+	return i.ctrl.Dialect.Name()
+}
+
+func (i *interceptor) txSpan(handler interface{}) (txSpan, bool) {
+	if handler == nil || !isComparable(handler) {
+		return txSpan{}, false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	t, ok := i.txs[handler]
+	return t, ok
+}
+
+// beginTx keeps the span of started transaction to use it as the parent of operations
+// in the transaction. If the transaction failed to start then the span is ended.
+func (i *interceptor) beginTx(ctx context.Context, span Span, op *sal.Operation, err error) {
+	if err == nil {
+		if tx, ok := op.Response.(*sal.SqlTx); ok && *tx != nil && isComparable(*tx) {
+			i.mu.Lock()
+			i.txs[*tx] = txSpan{ctx: ctx, span: span}
+			i.mu.Unlock()
+			return
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// endTx ends the span of transaction that is finished by Commit or Rollback.
+func (i *interceptor) endTx(handler interface{}, err error) {
+	if handler == nil || !isComparable(handler) {
+		return
+	}
+	i.mu.Lock()
+	t, ok := i.txs[handler]
+	delete(i.txs, handler)
+	i.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err != nil {
+		t.span.RecordError(err)
+	}
+	t.span.End()
+}
+
+func isComparable(v interface{}) bool {
+	return reflect.TypeOf(v).Comparable()
+}
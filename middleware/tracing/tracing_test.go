@@ -0,0 +1,85 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/go-gad/sal"
+	"github.com/go-gad/sal/examples/bookstore"
+	"github.com/go-gad/sal/middleware/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	recorder := tracing.NewRecorder()
+	client := bookstore.NewStore(db, tracing.Instrument(recorder))
+	ctx, root := recorder.Start(context.Background(), "request")
+
+	mock.ExpectPrepare(`SELECT \* FROM books`)
+	mock.ExpectQuery(`SELECT \* FROM books`).WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "foo"))
+	_, err = client.GetBooks(ctx, bookstore.GetBooksReq{})
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	tx, err := client.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+
+	req := bookstore.UpdateAuthorReq{ID: 123, BaseAuthor: bookstore.BaseAuthor{Name: "John", Desc: "foo-bar"}}
+	mock.ExpectPrepare("UPDATE authors SET.+")
+	mock.ExpectExec("UPDATE authors SET.+").WithArgs(req.Name, req.Desc, req.ID).WillReturnError(errors.New("conn reset"))
+	assert.NotNil(t, tx.UpdateAuthor(context.Background(), &req))
+
+	mock.ExpectRollback()
+	assert.Nil(t, tx.Tx().Rollback(context.Background()))
+	root.End()
+
+	spans := recorder.Spans()
+	names := make([]string, 0, len(spans))
+	byName := make(map[string]tracing.RecordedSpan)
+	for _, span := range spans {
+		names = append(names, span.Name)
+		byName[span.Name] = span
+	}
+	assert.Equal(t, []string{"Store.GetBooks", "Store.BeginTx", "Store.UpdateAuthor", "Rollback", tracing.TxSpanName, "request"}, names)
+
+	rootID, txID := byName["request"].ID, byName[tracing.TxSpanName].ID
+	assert.Equal(t, rootID, byName["Store.GetBooks"].ParentID)
+	assert.Equal(t, rootID, byName[tracing.TxSpanName].ParentID)
+	assert.Equal(t, txID, byName["Store.BeginTx"].ParentID)
+	assert.Equal(t, txID, byName["Store.UpdateAuthor"].ParentID)
+	assert.Equal(t, txID, byName["Rollback"].ParentID)
+
+	getBooks := byName["Store.GetBooks"]
+	assert.Equal(t, "postgresql", getBooks.Attributes[tracing.AttrSystem])
+	assert.Equal(t, "SELECT * FROM books", getBooks.Attributes[tracing.AttrStatement])
+	assert.Equal(t, "Query", getBooks.Attributes[tracing.AttrOperation])
+	assert.Equal(t, false, getBooks.Attributes[tracing.AttrTxOpened])
+
+	update := byName["Store.UpdateAuthor"]
+	assert.Equal(t, true, update.Attributes[tracing.AttrTxOpened])
+	assert.Len(t, update.Errors, 1)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestInstrument_Dialect(t *testing.T) {
+	recorder := tracing.NewRecorder()
+	ctrl := sal.NewController(sal.WithDialect(sal.DialectMySQL), tracing.Instrument(recorder))
+	err := ctrl.Invoke(context.Background(), &sal.Operation{Method: "Foo"}, func(ctx context.Context, op *sal.Operation) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	if spans := recorder.Spans(); assert.Len(t, spans, 1) {
+		assert.Equal(t, "Foo", spans[0].Name)
+		assert.Equal(t, "mysql", spans[0].Attributes[tracing.AttrSystem])
+	}
+}
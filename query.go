@@ -0,0 +1,360 @@
+package sal
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+)
+
+// parsedQuery contains the query with named args split to the chunks of raw sql.
+// The named arg with index i is placed between chunks i and i+1,
+// so the query always contains one chunk more than names.
+//
+//	SELECT * FROM authors WHERE id=@id AND name=@name
+//
+// is parsed to chunks
+//
+//	"SELECT * FROM authors WHERE id=", " AND name=", ""
+//
+// and names
+//
+//	"id", "name"
+type parsedQuery struct {
+	chunks []string
+	names  []string
+}
+
+// String assembles the parsed query back to the original form with named args.
+func (pq parsedQuery) String() string {
+	var b strings.Builder
+	for i, name := range pq.names {
+		b.WriteString(pq.chunks[i])
+		b.WriteByte('@')
+		b.WriteString(name)
+	}
+	b.WriteString(pq.chunks[len(pq.chunks)-1])
+
+	return b.String()
+}
+
+// render replaces the named args with placeholders of the dialect and returns
+// the query and the ordered list of names of args to bind.
+// If placeholders of dialect are numbered then the repeated named arg refers
+// to the same placeholder, so each name presents in the list only once.
+// The repeated named arg must be used with one type in all places, PostgreSQL rejects
+// the query like `a=@id OR b=@id::text` with "inconsistent types deduced for parameter $1".
+func (pq parsedQuery) render(d Dialect) (string, []string) {
+	var (
+		b     strings.Builder
+		names = make([]string, 0, len(pq.names))
+		pos   = make(map[string]int, len(pq.names))
+	)
+	for i, name := range pq.names {
+		b.WriteString(pq.chunks[i])
+		n, ok := pos[name]
+		if !ok || !d.Numbered() {
+			names = append(names, name)
+			n = len(names)
+			pos[name] = n
+		}
+		b.WriteString(d.Placeholder(n))
+	}
+	b.WriteString(pq.chunks[len(pq.chunks)-1])
+
+	return b.String(), names
+}
+
+// expandable reports whether any of args is Batch or, if lists is true, the slice
+// that is expanded to the list of values, see isList.
+func expandable(names []string, reqMap RowMap, lists bool) bool {
+	for _, name := range names {
+		val := reqMap.Get(name)
+		if _, ok := val.(Batch); ok {
+			return true
+		}
+		if lists && isList(val) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderExpanded is like render but also binds the values of args. The args of type Batch
+// are expanded to the lists of rows and, if lists is true, the slices are expanded
+// to the lists of values. Each value of expanded arg gets its own placeholder.
+//
+//	WHERE id IN (@ids) -> WHERE id IN (?, ?, ?)
+//
+// The empty slice is rendered as the subquery without rows, so IN (@ids) matches no rows
+// and NOT IN (@ids) matches all rows, see emptyList.
+func (pq parsedQuery) renderExpanded(d Dialect, reqMap RowMap, lists bool) (string, []string, []interface{}) {
+	var (
+		b     strings.Builder
+		names = make([]string, 0, len(pq.names))
+		args  = make([]interface{}, 0, len(pq.names))
+		pos   = make(map[string]int, len(pq.names))
+	)
+	for i, name := range pq.names {
+		b.WriteString(pq.chunks[i])
+		val := reqMap.Get(name)
+		if batch, ok := val.(Batch); ok {
+			for j, row := range batch.Rows {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString("(")
+				for k, v := range row {
+					if k > 0 {
+						b.WriteString(", ")
+					}
+					names = append(names, batch.Cols[k])
+					args = append(args, v)
+					b.WriteString(d.Placeholder(len(args)))
+				}
+				b.WriteString(")")
+			}
+			continue
+		}
+		if lists && isList(val) {
+			values := listValues(val)
+			if len(values) == 0 {
+				b.WriteString(emptyList(d))
+			}
+			for j, v := range values {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				names = append(names, name)
+				args = append(args, v)
+				b.WriteString(d.Placeholder(len(args)))
+			}
+			continue
+		}
+		n, ok := pos[name]
+		if !ok || !d.Numbered() {
+			names = append(names, name)
+			args = append(args, val)
+			n = len(args)
+			pos[name] = n
+		}
+		b.WriteString(d.Placeholder(n))
+	}
+	b.WriteString(pq.chunks[len(pq.chunks)-1])
+
+	return b.String(), names, args
+}
+
+// isList reports whether the value of arg is the slice or the pointer to slice that is expanded
+// to the list of values. The values of []byte and driver.Valuer, e.g. pq.Array, are bound as is.
+func isList(val interface{}) bool {
+	if _, ok := val.(driver.Valuer); ok {
+		return false
+	}
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// emptyList returns the subquery without rows that replaces the empty list of values,
+// the list of NULL would make NOT IN false for all rows.
+func emptyList(d Dialect) string {
+	switch d.Name() {
+	case DialectMySQL.Name(), DialectOracle.Name():
+		return "SELECT NULL FROM DUAL WHERE 1=0"
+	}
+	return "SELECT NULL WHERE 1=0"
+}
+
+// listValues returns the elements of slice arg, see isList.
+func listValues(val interface{}) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(val))
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+// syntax describes the specifics of SQL syntax of dialect that affect the search of named args.
+type syntax struct {
+	// backslash escapes the quote inside of '…' and "…", as in MySQL.
+	backslash bool
+	// hashComment starts the line comment with #, as in MySQL.
+	hashComment bool
+	// brackets quote identifiers with [ and ], as in SQL Server.
+	brackets bool
+	// dollarQuoted strings $$…$$ are supported, as in PostgreSQL.
+	dollarQuoted bool
+}
+
+// syntaxOf returns the syntax of dialect. The unknown dialects are treated as PostgreSQL.
+func syntaxOf(d Dialect) syntax {
+	switch d.Name() {
+	case DialectMySQL.Name():
+		return syntax{backslash: true, hashComment: true}
+	case DialectSQLServer.Name():
+		return syntax{brackets: true}
+	case DialectSQLite.Name(), DialectOracle.Name():
+		return syntax{}
+	}
+	return syntax{dollarQuoted: true}
+}
+
+// parseQuery looks for the named args in the query. It's aware of SQL syntax of dialect d, so
+// the symbol `@` isn't treated as a beginning of the named arg inside of:
+//   - string constants 'admin@example.com', including E-strings E'it\'s @me'
+//     and strings with backslash escapes 'it\'s @me' of MySQL;
+//   - quoted identifiers "@weird_column", `@weird_column` and [@weird_column] of SQL Server;
+//   - dollar-quoted strings $$ @body $$ and $fn$ @body $fn$ of PostgreSQL;
+//   - line comments -- @note and # @note of MySQL, block comments /* @note */, which can be nested;
+//   - operators like @>, <@, @@ and @-@.
+func parseQuery(query string, d Dialect) parsedQuery {
+	var (
+		pq    = parsedQuery{chunks: make([]string, 0, 1)}
+		syn   = syntaxOf(d)
+		start int
+	)
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '\'':
+			i = skipQuoted(query, i+1, '\'', syn.backslash || isEString(query, i))
+		case c == '"':
+			i = skipQuoted(query, i+1, c, syn.backslash)
+		case c == '`':
+			i = skipQuoted(query, i+1, c, false)
+		case c == '[' && syn.brackets:
+			i = skipQuoted(query, i+1, ']', false)
+		case c == '-' && next(query, i) == '-':
+			i = skipLineComment(query, i+2)
+		case c == '#' && syn.hashComment:
+			i = skipLineComment(query, i+1)
+		case c == '/' && next(query, i) == '*':
+			i = skipBlockComment(query, i+2)
+		case c == '$' && syn.dollarQuoted:
+			i = skipDollarQuoted(query, i)
+		case c == '@' && isNamedArg(query, i):
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			pq.chunks = append(pq.chunks, query[start:i])
+			pq.names = append(pq.names, query[i+1:end])
+			start, i = end, end
+		default:
+			i++
+		}
+	}
+	pq.chunks = append(pq.chunks, query[start:])
+
+	return pq
+}
+
+// next returns the byte after position i or zero if the end of query is reached.
+func next(query string, i int) byte {
+	if i+1 < len(query) {
+		return query[i+1]
+	}
+	return 0
+}
+
+// isNamedArg reports whether the symbol `@` on position i starts the named arg.
+// The doubled `@@` is an operator, so neither of the symbols starts the named arg.
+func isNamedArg(query string, i int) bool {
+	if i > 0 && query[i-1] == '@' {
+		return false
+	}
+	return isIdentChar(next(query, i))
+}
+
+// isEString reports whether the quote on position i opens the string constant
+// with C-style escapes, E'foo\'s bar'.
+func isEString(query string, i int) bool {
+	if i == 0 || (query[i-1] != 'E' && query[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentChar(query[i-2])
+}
+
+// skipQuoted returns the position after the closing quote. The quote inside
+// is escaped by doubling, and by backslash if backslash escapes are enabled.
+func skipQuoted(query string, i int, quote byte, backslash bool) int {
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if next(query, i) != quote {
+				return i + 1
+			}
+			i++
+		}
+		i++
+	}
+	return len(query)
+}
+
+// skipLineComment returns the position of the beginning of the next line.
+func skipLineComment(query string, i int) int {
+	if n := strings.IndexByte(query[i:], '\n'); n >= 0 {
+		return i + n + 1
+	}
+	return len(query)
+}
+
+// skipBlockComment returns the position after the end of the block comment.
+// Block comments can be nested as in PostgreSQL.
+func skipBlockComment(query string, i int) int {
+	depth := 1
+	for i < len(query) {
+		switch {
+		case query[i] == '/' && next(query, i) == '*':
+			depth++
+			i += 2
+		case query[i] == '*' && next(query, i) == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(query)
+}
+
+// skipDollarQuoted returns the position after the dollar-quoted string constant
+// that starts on position i. If the symbol `$` doesn't start the tag then it's just skipped,
+// it can be a positional parameter $1 or a part of identifier foo$bar.
+func skipDollarQuoted(query string, i int) int {
+	if i > 0 && isIdentChar(query[i-1]) {
+		return i + 1
+	}
+	end := i + 1
+	for end < len(query) && query[end] != '$' {
+		if !isIdentChar(query[end]) || (end == i+1 && isDigit(query[end])) {
+			return i + 1
+		}
+		end++
+	}
+	if end == len(query) {
+		return i + 1
+	}
+	tag := query[i : end+1]
+	if n := strings.Index(query[end+1:], tag); n >= 0 {
+		return end + 1 + n + len(tag)
+	}
+	return len(query)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
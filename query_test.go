@@ -0,0 +1,203 @@
+package sal
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, tc := range []struct {
+		test  string
+		query string
+		names []string
+	}{
+		{
+			test:  "no args",
+			query: `SELECT * FROM authors`,
+			names: nil,
+		}, {
+			test:  "simple",
+			query: `UPDATE authors SET name=@name WHERE id=@id`,
+			names: []string{"name", "id"},
+		}, {
+			test:  "at the end and at the beginning",
+			query: `@id`,
+			names: []string{"id"},
+		}, {
+			test:  "cast",
+			query: `DELETE FROM authors WHERE tags=ANY(@tags::UUID[]) AND id=@id::int8`,
+			names: []string{"tags", "id"},
+		}, {
+			test:  "string constant",
+			query: `SELECT * FROM users WHERE email='admin@example.com' AND id=@id`,
+			names: []string{"id"},
+		}, {
+			test:  "doubled quote in string constant",
+			query: `SELECT 'it''s @not_arg', @arg`,
+			names: []string{"arg"},
+		}, {
+			test:  "backslash in standard string constant",
+			query: `SELECT 'C:\', @arg, '\@not_arg'`,
+			names: []string{"arg"},
+		}, {
+			test:  "E-string",
+			query: `SELECT E'it\'s @not_arg', e'\\', @arg`,
+			names: []string{"arg"},
+		}, {
+			test:  "typed literal of type ending with e isn't E-string",
+			query: `SELECT name'\', @id`,
+			names: []string{"id"},
+		}, {
+			test:  "quoted identifier",
+			query: `SELECT "@col", "a""@b" FROM t WHERE id=@id`,
+			names: []string{"id"},
+		}, {
+			test:  "line comment",
+			query: "SELECT * FROM t -- filter by @id\nWHERE id=@id -- @tail",
+			names: []string{"id"},
+		}, {
+			test:  "block comment",
+			query: `SELECT /* @a /* nested @b */ still comment @c */ @id`,
+			names: []string{"id"},
+		}, {
+			test:  "dollar quoted",
+			query: `SELECT $$ @a 'b' $$, $fn$ @c $$ @d $fn$, @id`,
+			names: []string{"id"},
+		}, {
+			test:  "positional param and identifier with dollar",
+			query: `SELECT foo$bar$, $1, @id, $2 FROM t`,
+			names: []string{"id"},
+		}, {
+			test:  "operators",
+			query: `SELECT * FROM t WHERE tags @> @tags AND @tags <@ tags AND doc @@ @q AND @-@ path > 0`,
+			names: []string{"tags", "tags", "q"},
+		}, {
+			test:  "unterminated string",
+			query: `SELECT @id, 'broken @arg`,
+			names: []string{"id"},
+		}, {
+			test:  "unterminated block comment",
+			query: `SELECT @id /* @arg`,
+			names: []string{"id"},
+		}, {
+			test:  "unterminated dollar quoted",
+			query: `SELECT @id, $tag$ @arg`,
+			names: []string{"id"},
+		},
+	} {
+		t.Run(tc.test, func(t *testing.T) {
+			pq := parseQuery(tc.query, DialectPostgreSQL)
+			assert.Equal(t, tc.names, pq.names)
+			assert.Equal(t, len(pq.names)+1, len(pq.chunks))
+			assert.Equal(t, tc.query, pq.String())
+		})
+	}
+}
+
+func TestParseQuery_Dialects(t *testing.T) {
+	for _, tc := range []struct {
+		test    string
+		dialect Dialect
+		query   string
+		names   []string
+		render  string
+	}{
+		{
+			test:    "mysql backslash in string",
+			dialect: DialectMySQL,
+			query:   `SELECT * FROM t WHERE a='it\'s @x' AND b=@b`,
+			names:   []string{"b"},
+			render:  `SELECT * FROM t WHERE a='it\'s @x' AND b=?`,
+		}, {
+			test:    "mysql backslash in double quoted string",
+			dialect: DialectMySQL,
+			query:   `SELECT * FROM t WHERE a="say \"@x\"" AND b=@b`,
+			names:   []string{"b"},
+			render:  `SELECT * FROM t WHERE a="say \"@x\"" AND b=?`,
+		}, {
+			test:    "mysql hash comment",
+			dialect: DialectMySQL,
+			query:   "SELECT * FROM t WHERE a='it\\'s @x' AND b=@b # @c\nAND d=@d",
+			names:   []string{"b", "d"},
+			render:  "SELECT * FROM t WHERE a='it\\'s @x' AND b=? # @c\nAND d=?",
+		}, {
+			test:    "mysql dollar isn't quote",
+			dialect: DialectMySQL,
+			query:   "SELECT $$ FROM t WHERE a=@a AND b=$$",
+			names:   []string{"a"},
+			render:  "SELECT $$ FROM t WHERE a=? AND b=$$",
+		}, {
+			test:    "postgres backslash in standard string",
+			dialect: DialectPostgreSQL,
+			query:   `SELECT * FROM t WHERE a='C:\' AND b=@b # @c`,
+			names:   []string{"b", "c"},
+			render:  `SELECT * FROM t WHERE a='C:\' AND b=$1 # $2`,
+		}, {
+			test:    "sqlserver brackets",
+			dialect: DialectSQLServer,
+			query:   `SELECT [@col], [a]]@b] FROM t WHERE id=@id`,
+			names:   []string{"id"},
+			render:  `SELECT [@col], [a]]@b] FROM t WHERE id=@p1`,
+		}, {
+			test:    "postgres array brackets",
+			dialect: DialectPostgreSQL,
+			query:   `SELECT tags[@i] FROM t WHERE id=@id`,
+			names:   []string{"i", "id"},
+			render:  `SELECT tags[$1] FROM t WHERE id=$2`,
+		}, {
+			test:    "sqlite",
+			dialect: DialectSQLite,
+			query:   `SELECT 'it''s @x', "@col" FROM t WHERE id=@id -- @c`,
+			names:   []string{"id"},
+			render:  `SELECT 'it''s @x', "@col" FROM t WHERE id=? -- @c`,
+		}, {
+			test:    "oracle",
+			dialect: DialectOracle,
+			query:   `SELECT 'a@b' FROM t WHERE id=@id /* @c */`,
+			names:   []string{"id"},
+			render:  `SELECT 'a@b' FROM t WHERE id=:1 /* @c */`,
+		},
+	} {
+		t.Run(tc.test, func(t *testing.T) {
+			pq := parseQuery(tc.query, tc.dialect)
+			assert.Equal(t, tc.names, pq.names)
+			assert.Equal(t, tc.query, pq.String())
+			query, _ := pq.render(tc.dialect)
+			assert.Equal(t, tc.render, query)
+		})
+	}
+}
+
+func TestParseQuery_Quick(t *testing.T) {
+	// the query is assembled from the pieces of sql to increase the chance
+	// of getting the tricky combinations of quotes, comments and args.
+	pieces := []string{"@", "id", "'", "\"", "E", "$", "$$", "$t$", "--", "\n", "/*", "*/", "\\", " ", ":", "@@", ">", "1", "#", "[", "]"}
+	f := func(ind []uint8) bool {
+		var b strings.Builder
+		for _, i := range ind {
+			b.WriteString(pieces[int(i)%len(pieces)])
+		}
+		query := b.String()
+		for _, d := range []Dialect{DialectPostgreSQL, DialectMySQL, DialectSQLServer} {
+			pq := parseQuery(query, d)
+			if len(pq.chunks) != len(pq.names)+1 {
+				return false
+			}
+			for _, name := range pq.names {
+				if name == "" {
+					return false
+				}
+			}
+			if pq.String() != query {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,171 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PrimaryReader is an interface of request that routes the query of method to the primary handler
+// of Router, e.g. when the query modifies the data or reads the data that is just written.
+//
+//	func (r *CreateAuthorReq) ReadPrimary() {}
+type PrimaryReader interface {
+	ReadPrimary()
+}
+
+// Router is the QueryHandler that splits the reads and writes across the primary handler and replicas.
+// The operations of type Query and QueryRow are executed on one of replicas,
+// the other operations and all operations in transactions are executed on the primary.
+// The method with PrimaryReader request is executed on the primary as well.
+//
+//	client := NewStore(sal.NewRouter(primary, []sal.QueryHandler{replica1, replica2}))
+//
+// The operation is routed by the OperationInfo stored in the context, so the queries that are executed
+// directly on the router without the info go to the primary.
+// By default the replica is selected in round-robin order, see LeastLatency.
+type Router struct {
+	Primary QueryHandler
+
+	replicas     []*replica
+	next         uint32
+	leastLatency bool
+}
+
+// RouterOption sets the optional parameters of Router.
+type RouterOption func(r *Router)
+
+// LeastLatency sets the selection of replica with the least average latency of queries.
+func LeastLatency() RouterOption {
+	return func(r *Router) { r.leastLatency = true }
+}
+
+type replica struct {
+	QueryHandler
+
+	mu      sync.Mutex
+	latency time.Duration
+}
+
+// NewRouter returns the router of queries. If there are no replicas then all queries go to the primary.
+func NewRouter(primary QueryHandler, replicas []QueryHandler, opts ...RouterOption) *Router {
+	r := &Router{Primary: primary}
+	for _, qh := range replicas {
+		r.replicas = append(r.replicas, &replica{QueryHandler: qh})
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// QueryContext executes the query on the handler that is selected by the operation in ctx.
+func (r *Router) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if rep := r.replicaFor(ctx); rep != nil {
+		defer rep.observe(time.Now())
+		return rep.QueryContext(ctx, query, args...)
+	}
+	return r.Primary.QueryContext(ctx, query, args...)
+}
+
+// ExecContext executes the query on the primary.
+func (r *Router) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.Primary.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext prepares the statement on the primary.
+// The statements for replicas are prepared and cached by the Controller.
+func (r *Router) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return r.Primary.PrepareContext(ctx, query)
+}
+
+// BeginTx starts the transaction on the primary.
+func (r *Router) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	txb, ok := r.Primary.(TransactionBegin)
+	if !ok {
+		return nil, errors.Errorf("failed to start tx: primary %T doesn't implement BeginTx", r.Primary)
+	}
+	return txb.BeginTx(ctx, opts)
+}
+
+// replicaFor returns the replica to execute the operation in ctx or nil if it goes to the primary.
+func (r *Router) replicaFor(ctx context.Context) *replica {
+	if len(r.replicas) == 0 {
+		return nil
+	}
+	info, ok := OperationFromContext(ctx)
+	if !ok || info.TxOpened || info.Primary {
+		return nil
+	}
+	if info.Type != OperationTypeQuery && info.Type != OperationTypeQueryRow {
+		return nil
+	}
+
+	// the replicas with equal latency are selected in round-robin order.
+	n := uint32(len(r.replicas))
+	start := atomic.AddUint32(&r.next, 1) - 1
+	best := r.replicas[start%n]
+	if !r.leastLatency {
+		return best
+	}
+	min := best.avgLatency()
+	for i := uint32(1); i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if l := rep.avgLatency(); l < min {
+			best, min = rep, l
+		}
+	}
+	return best
+}
+
+func (rep *replica) avgLatency() time.Duration {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.latency
+}
+
+// observe updates the moving average of latency with the duration of query started at start.
+func (rep *replica) observe(start time.Time) {
+	d := time.Since(start)
+	rep.mu.Lock()
+	if rep.latency == 0 {
+		rep.latency = d
+	} else {
+		rep.latency += (d - rep.latency) / 8
+	}
+	rep.mu.Unlock()
+}
+
+// replicaStmt measures the latency of queries executed on the replica.
+type replicaStmt struct {
+	Stmt
+	rep *replica
+}
+
+func (s replicaStmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	defer s.rep.observe(time.Now())
+	return s.Stmt.QueryContext(ctx, args...)
+}
+
+// replicaStmt returns the statement to execute the query on the replica.
+// The prepared statements are cached for each replica, because they are bound to its connections.
+func (ctrl *Controller) replicaStmt(ctx context.Context, rep *replica, query string) (Stmt, error) {
+	if ctrl.SkipPrepare {
+		return replicaStmt{Stmt: DirectStmt(rep.QueryHandler, query), rep: rep}, nil
+	}
+	cache := ctrl.handlerCache(rep)
+	stmt, release := cache.acquire(query)
+	if stmt == nil {
+		var err error
+		stmt, err = ctrl.prepareStmt(ctx, rep.QueryHandler, query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to prepare stmt on replica on query %q", query)
+		}
+		stmt, release = cache.putAcquire(query, stmt)
+	}
+	return replicaStmt{Stmt: stmtOf(stmt, release), rep: rep}, nil
+}
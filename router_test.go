@@ -0,0 +1,88 @@
+package sal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_replicaFor(t *testing.T) {
+	r := NewRouter(nil, []QueryHandler{nil, nil})
+	read := func(info OperationInfo) context.Context {
+		return WithOperation(context.Background(), &info)
+	}
+
+	assert.Nil(t, r.replicaFor(context.Background()))
+	assert.Nil(t, r.replicaFor(read(OperationInfo{Type: OperationTypeExec})))
+	assert.Nil(t, r.replicaFor(read(OperationInfo{Type: OperationTypeQuery, TxOpened: true})))
+	assert.Nil(t, r.replicaFor(read(OperationInfo{Type: OperationTypeQueryRow, Primary: true})))
+
+	ctx := read(OperationInfo{Type: OperationTypeQuery})
+	assert.Equal(t, r.replicas[0], r.replicaFor(ctx))
+	assert.Equal(t, r.replicas[1], r.replicaFor(ctx))
+	assert.Equal(t, r.replicas[0], r.replicaFor(ctx))
+
+	assert.Nil(t, NewRouter(nil, nil).replicaFor(ctx))
+}
+
+func TestRouter_LeastLatency(t *testing.T) {
+	r := NewRouter(nil, []QueryHandler{nil, nil, nil}, LeastLatency())
+	ctx := WithOperation(context.Background(), &OperationInfo{Type: OperationTypeQueryRow})
+
+	r.replicas[0].latency = 30 * time.Millisecond
+	r.replicas[1].latency = 10 * time.Millisecond
+	r.replicas[2].latency = 20 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, r.replicas[1], r.replicaFor(ctx))
+	}
+
+	r.replicas[1].observe(time.Now().Add(-330 * time.Millisecond))
+	assert.Equal(t, 50*time.Millisecond, r.replicas[1].avgLatency().Round(10*time.Millisecond))
+	assert.Equal(t, r.replicas[2], r.replicaFor(ctx))
+}
+
+func TestController_ReplicaStmt(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer primary.Close()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctrl := NewController(StmtCacheSize(1))
+	r := NewRouter(primary, []QueryHandler{db})
+	ctx := WithOperation(context.Background(), &OperationInfo{Type: OperationTypeQuery})
+	query := func(query string) {
+		stmt, err := ctrl.Stmt(ctx, nil, r, query)
+		if !assert.NoError(t, err) {
+			return
+		}
+		rows, err := stmt.QueryContext(ctx)
+		if assert.NoError(t, err) {
+			rows.Close()
+		}
+	}
+
+	// the cache of replica has the size of controller's cache.
+	mock.ExpectPrepare("SELECT 1").WillBeClosed()
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	query("SELECT 1")
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	query("SELECT 1")
+	mock.ExpectPrepare("SELECT 2").WillBeClosed()
+	mock.ExpectQuery("SELECT 2").WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	query("SELECT 2")
+	assert.Equal(t, StmtCacheStats{Size: 1, Hits: 1, Misses: 2, Evictions: 1}, ctrl.StmtCacheStats())
+
+	// the statements of replica are closed with the controller.
+	assert.NoError(t, ctrl.Close())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
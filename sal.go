@@ -3,27 +3,24 @@ package sal
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"regexp"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-// reQueryArgs represents the regexp to define named args in query.
-var reQueryArgs = regexp.MustCompile("@[A-Za-z0-9_]+")
-
 // QueryArgs receives the query with named arguments
 // and returns a query with posgtresql placeholders and a ordered slice named args.
+// The repeated named arg refers to the same placeholder, so each name presents
+// in the slice only once.
+//
+//	WHERE a=@id OR b=@id AND c=@name -> WHERE a=$1 OR b=$1 AND c=$2, [id, name]
 //
-// Naive implementation.
+// The query is parsed with respect to SQL syntax, see parseQuery for details.
+// To get the query with placeholders of another database use the Controller with Dialect.
 func QueryArgs(query string) (string, []string) {
-	var args = make([]string, 0)
-	pgQuery := reQueryArgs.ReplaceAllStringFunc(query, func(arg string) string {
-		args = append(args, arg[1:])
-		return fmt.Sprintf("$%d", len(args))
-	})
-	return pgQuery, args
+	return parseQuery(query, DialectPostgreSQL).render(DialectPostgreSQL)
 }
 
 // RowMap contains mapping between column name in database and interface of value.
@@ -48,6 +45,15 @@ func (rm RowMap) Set(key string, val interface{}) {
 	rm[key] = []interface{}{val}
 }
 
+// Values returns the first values of keys in order of keys.
+func (rm RowMap) Values(keys []string) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = rm.Get(key)
+	}
+	return values
+}
+
 func (rm RowMap) GetByIndex(key string, index int) interface{} {
 	v := rm[key]
 	if len(v) == 0 || len(v) < index+1 {
@@ -69,13 +75,18 @@ func (m mapIndex) NextVal(key string) int {
 }
 
 // ProcessQueryAndArgs process query with named args to driver specific query.
+// The value of repeated named arg is bound only once.
 func ProcessQueryAndArgs(query string, reqMap RowMap) (string, []interface{}) {
 	pgQuery, argsNames := QueryArgs(query)
+	return pgQuery, bindArgs(argsNames, reqMap)
+}
+
+func bindArgs(argsNames []string, reqMap RowMap) []interface{} {
 	var args = make([]interface{}, 0, len(argsNames))
 	for _, name := range argsNames {
 		args = append(args, reqMap.Get(name))
 	}
-	return pgQuery, args
+	return args
 }
 
 type skippedField interface{}
@@ -112,6 +123,51 @@ type ProcessRower interface {
 	ProcessRow(rowMap RowMap)
 }
 
+// NoPreparer is an interface of request that disables the preparing of statement for the method.
+// The query is executed directly on the QueryHandler with bound args.
+//
+//	func (r *GetAuthorsReq) NoPrepare() {}
+type NoPreparer interface {
+	NoPrepare()
+}
+
+// ErrStopIteration is returned by the callback of streaming method to stop the iteration without error.
+// The rows are closed and the method returns nil.
+//
+//	err := client.GetAuthorsEach(ctx, req, func(resp *GetAuthorsResp) error {
+//		if resp.ID == id {
+//			found = resp
+//			return sal.ErrStopIteration
+//		}
+//		return nil
+//	})
+var ErrStopIteration = errors.New("sal: stop iteration")
+
+// Stmt describes the methods to execute the query with bound args.
+// It's implemented by *sql.Stmt and by the statement returned by DirectStmt.
+type Stmt interface {
+	QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error)
+}
+
+// DirectStmt returns the Stmt that executes the query directly on the handler without preparing.
+func DirectStmt(qh QueryHandler, query string) Stmt {
+	return directStmt{qh: qh, query: query}
+}
+
+type directStmt struct {
+	qh    QueryHandler
+	query string
+}
+
+func (s directStmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	return s.qh.QueryContext(ctx, s.query, args...)
+}
+
+func (s directStmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	return s.qh.ExecContext(ctx, s.query, args...)
+}
+
 // QueryHandler describes the methods that are required to pass to constructor of the object
 // implementation of user interface.
 type QueryHandler interface {
@@ -125,6 +181,19 @@ type TransactionBegin interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
+// StmtContexter describes the method of transaction to get the transaction-specific statement
+// from an existing one. It's implemented by *sql.Tx and by any wrapper of transaction that satisfies SqlTx.
+type StmtContexter interface {
+	StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
+}
+
+// TxContexter describes the methods of transaction that are finished with the context, e.g. Savepoint.
+// If the transaction implements it then WrappedTx passes the context of Commit and Rollback to it.
+type TxContexter interface {
+	CommitContext(ctx context.Context) error
+	RollbackContext(ctx context.Context) error
+}
+
 // Txer describes the method to return implementation of Transaction interface.
 type Txer interface {
 	Tx() Transaction
@@ -147,6 +216,10 @@ type Transaction interface {
 	StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
 	Commit(ctx context.Context) error
 	Rollback(ctx context.Context) error
+	// AfterCommit registers the callback that is called once after the successful commit of transaction.
+	AfterCommit(fn TxCallback)
+	// AfterRollback registers the callback that is called once after the rollback of transaction.
+	AfterRollback(fn TxCallback)
 }
 
 // WrappedTx is a struct that is an implementation of Transaction interface.
@@ -167,6 +240,7 @@ func NewWrappedTx(tx SqlTx, ctrl *Controller) *WrappedTx {
 func (wtx *WrappedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypeQuery.String())
+	ctx = WithOperation(ctx, &OperationInfo{Method: "QueryContext", Type: OperationTypeQuery, RawQuery: query, Query: query, Args: args, TxOpened: true, Tx: wtx})
 	var (
 		resp *sql.Rows
 		err  error
@@ -179,15 +253,26 @@ func (wtx *WrappedTx) QueryContext(ctx context.Context, query string, args ...in
 		}
 	}
 
-	resp, err = wtx.Tx.QueryContext(ctx, query, args...)
+	op := &Operation{Method: "QueryContext", Type: OperationTypeQuery, Query: query, Args: args, Response: &resp, Handler: wtx.Tx}
+	err = wtx.ctrl.Invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		resp, err = wtx.Tx.QueryContext(ctx, op.Query, op.Args...)
+		return err
+	})
+	if err != nil {
+		err = wtx.ctrl.HandleError(ctx, err)
+		return nil, err
+	}
+	wtx.ctrl.HandleQueryResult(ctx, -1, resp)
 
-	return resp, err
+	return resp, nil
 }
 
 // Exec executes a query without returning any rows. The args are for any placeholder parameters in the query.
 func (wtx *WrappedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypeExec.String())
+	ctx = WithOperation(ctx, &OperationInfo{Method: "ExecContext", Type: OperationTypeExec, RawQuery: query, Query: query, Args: args, TxOpened: true, Tx: wtx})
 	var (
 		resp sql.Result
 		err  error
@@ -200,9 +285,19 @@ func (wtx *WrappedTx) ExecContext(ctx context.Context, query string, args ...int
 		}
 	}
 
-	resp, err = wtx.Tx.ExecContext(ctx, query, args...)
+	op := &Operation{Method: "ExecContext", Type: OperationTypeExec, Query: query, Args: args, Response: &resp, Handler: wtx.Tx}
+	err = wtx.ctrl.Invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		resp, err = wtx.Tx.ExecContext(ctx, op.Query, op.Args...)
+		return err
+	})
+	if err != nil {
+		err = wtx.ctrl.HandleError(ctx, err)
+		return nil, err
+	}
+	wtx.ctrl.HandleExecResult(ctx, resp)
 
-	return resp, err
+	return resp, nil
 }
 
 // PrepareContext creates a prepared statement for later queries or executions.
@@ -213,6 +308,7 @@ func (wtx *WrappedTx) ExecContext(ctx context.Context, query string, args ...int
 func (wtx *WrappedTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypePrepare.String())
+	ctx = WithOperation(ctx, &OperationInfo{Method: "PrepareContext", Type: OperationTypePrepare, RawQuery: query, Query: query, TxOpened: true, Tx: wtx})
 	var (
 		resp *sql.Stmt
 		err  error
@@ -226,14 +322,19 @@ func (wtx *WrappedTx) PrepareContext(ctx context.Context, query string) (*sql.St
 	}
 
 	resp, err = wtx.Tx.PrepareContext(ctx, query)
+	if err != nil {
+		err = wtx.ctrl.HandleError(ctx, err)
+		return nil, err
+	}
 
-	return resp, err
+	return resp, nil
 }
 
 // Stmt returns a transaction-specific prepared statement from an existing statement.
 func (wtx *WrappedTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypeStmt.String())
+	ctx = WithOperation(ctx, &OperationInfo{Method: "StmtContext", Type: OperationTypeStmt, TxOpened: true, Tx: wtx})
 	for _, fn := range wtx.ctrl.BeforeQuery {
 		var fnz FinalizerFunc
 		ctx, fnz = fn(ctx, "", nil)
@@ -250,6 +351,7 @@ func (wtx *WrappedTx) Commit(ctx context.Context) error {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypeCommit.String())
 	ctx = context.WithValue(ctx, ContextKeyMethodName, "Commit")
+	ctx = WithOperation(ctx, &OperationInfo{Method: "Commit", Type: OperationTypeCommit, RawQuery: "COMMIT", Query: "COMMIT", TxOpened: true, Tx: wtx})
 	var err error
 	for _, fn := range wtx.ctrl.BeforeQuery {
 		var fnz FinalizerFunc
@@ -259,7 +361,18 @@ func (wtx *WrappedTx) Commit(ctx context.Context) error {
 		}
 	}
 
-	err = wtx.Tx.Commit()
+	wtx.ctrl.untrackTx(wtx.Tx)
+	op := &Operation{Method: "Commit", Type: OperationTypeCommit, Query: "COMMIT", Handler: wtx.Tx}
+	err = wtx.ctrl.Invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		if tx, ok := wtx.Tx.(TxContexter); ok {
+			return tx.CommitContext(ctx)
+		}
+		return wtx.Tx.Commit()
+	})
+	wtx.ctrl.finishTx(ctx, wtx.Tx, err == nil)
+	if err != nil {
+		err = wtx.ctrl.HandleError(ctx, err)
+	}
 
 	return err
 }
@@ -269,6 +382,7 @@ func (wtx *WrappedTx) Rollback(ctx context.Context) error {
 	ctx = context.WithValue(ctx, ContextKeyTxOpened, true)
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypeRollback.String())
 	ctx = context.WithValue(ctx, ContextKeyMethodName, "Rollback")
+	ctx = WithOperation(ctx, &OperationInfo{Method: "Rollback", Type: OperationTypeRollback, RawQuery: "ROLLBACK", Query: "ROLLBACK", TxOpened: true, Tx: wtx})
 	var err error
 	for _, fn := range wtx.ctrl.BeforeQuery {
 		var fnz FinalizerFunc
@@ -278,51 +392,179 @@ func (wtx *WrappedTx) Rollback(ctx context.Context) error {
 		}
 	}
 
-	err = wtx.Tx.Rollback()
+	wtx.ctrl.untrackTx(wtx.Tx)
+	op := &Operation{Method: "Rollback", Type: OperationTypeRollback, Query: "ROLLBACK", Handler: wtx.Tx}
+	err = wtx.ctrl.Invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		if tx, ok := wtx.Tx.(TxContexter); ok {
+			return tx.RollbackContext(ctx)
+		}
+		return wtx.Tx.Rollback()
+	})
+	wtx.ctrl.finishTx(ctx, wtx.Tx, false)
+	if err != nil {
+		err = wtx.ctrl.HandleError(ctx, err)
+	}
 
 	return err
 }
 
-// Controller is a manager of query processing. Contains the stack of middlewares
-// and cache of prepared statements.
+// Controller is a manager of query processing. Contains the stack of middlewares,
+// cache of prepared statements and the dialect of database.
+// It also tracks the statements used in transactions to close them
+// when the transaction is committed or rolled back with WrappedTx.
+// The transaction passed to the client as the handler must be finished through Tx() of client,
+// e.g. client.Tx().Commit(ctx), otherwise its statements and callbacks are kept by the controller.
 type Controller struct {
-	BeforeQuery []BeforeQueryFunc
+	BeforeQuery  []BeforeQueryFunc
+	AfterExec    []AfterExecFunc
+	AfterQuery   []AfterQueryFunc
+	OnError      []OnErrorFunc
+	Interceptors []Interceptor
 	sync.RWMutex
-	CacheStmts map[string]*sql.Stmt
+	CacheStmts  *StmtCache
+	Dialect     Dialect
+	SkipPrepare bool
+	SkipCopy    bool
+	RetryPolicy RetryPolicy
+
+	queryCacheSize int
+	queries        *lruCache
+	stmtCacheSize  int
+	txStmts        map[interface{}][]*sql.Stmt
+	txCallbacks    map[interface{}]*txCallbacks
+	leakDetector   *TxLeakDetector
+	openTxs        map[interface{}]*openTx
+	handlerStmts   map[interface{}]*StmtCache
 }
 
+// DefaultQueryCacheSize is the default number of processed queries cached by the Controller.
+const DefaultQueryCacheSize = 1000
+
 // NewController retunes a new object of Controller.
+// By default the controller uses DialectPostgreSQL.
 func NewController(options ...ClientOption) *Controller {
 	ctrl := &Controller{
-		BeforeQuery: []BeforeQueryFunc{},
-		CacheStmts:  make(map[string]*sql.Stmt),
+		BeforeQuery:    []BeforeQueryFunc{},
+		Dialect:        DialectPostgreSQL,
+		RetryPolicy:    DefaultRetryPolicy,
+		queryCacheSize: DefaultQueryCacheSize,
+		stmtCacheSize:  DefaultStmtCacheSize,
 	}
 	for _, option := range options {
 		option(ctrl)
 	}
+	ctrl.queries = newLRUCache(ctrl.queryCacheSize)
+	ctrl.CacheStmts = NewStmtCache(ctrl.stmtCacheSize)
 	return ctrl
 }
 
-func (ctrl *Controller) findStmt(query string) *sql.Stmt {
-	ctrl.RLock()
-	stmt, ok := ctrl.CacheStmts[query]
-	ctrl.RUnlock()
-	if ok {
-		return stmt
+// Close closes all cached prepared statements, including the statements prepared on shards and replicas.
+// The controller is shared by the client and its transactions, so it should be closed
+// when the client is no longer needed.
+func (ctrl *Controller) Close() error {
+	err := ctrl.CacheStmts.Close()
+	ctrl.Lock()
+	caches := ctrl.handlerStmts
+	ctrl.handlerStmts = nil
+	ctrl.Unlock()
+	for _, cache := range caches {
+		if cerr := cache.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Invoke executes the operation with invoker through the chain of interceptors.
+// The first registered interceptor is the outermost one.
+func (ctrl *Controller) Invoke(ctx context.Context, op *Operation, invoker Invoker) error {
+	next := invoker
+	for i := len(ctrl.Interceptors) - 1; i >= 0; i-- {
+		interceptor, invoke := ctrl.Interceptors[i], next
+		next = func(ctx context.Context, op *Operation) error {
+			return interceptor(ctx, op, invoke)
+		}
 	}
+	return next(ctx, op)
+}
 
-	return nil
+// HandleExecResult calls the AfterExec hooks with the result of successful Exec operation.
+func (ctrl *Controller) HandleExecResult(ctx context.Context, res sql.Result) {
+	for _, fn := range ctrl.AfterExec {
+		fn(ctx, res)
+	}
 }
 
-func (ctrl *Controller) putStmt(query string, stmt *sql.Stmt) {
-	ctrl.Lock()
-	ctrl.CacheStmts[query] = stmt
-	ctrl.Unlock()
+// HandleQueryResult calls the AfterQuery hooks with the number of scanned rows and
+// the response of successful Query or QueryRow operation.
+func (ctrl *Controller) HandleQueryResult(ctx context.Context, rows int, resp interface{}) {
+	for _, fn := range ctrl.AfterQuery {
+		fn(ctx, rows, resp)
+	}
+}
+
+// HandleError passes the error through the OnError hooks and returns the resulting error.
+func (ctrl *Controller) HandleError(ctx context.Context, err error) error {
+	for _, fn := range ctrl.OnError {
+		if e := fn(ctx, err); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// processedQuery is the query with placeholders of dialect and the ordered names of args.
+type processedQuery struct {
+	query  string
+	names  []string
+	parsed parsedQuery
+}
+
+// ProcessQueryAndArgs process query with named args to the query with placeholders
+// of the controller's dialect and returns it with the ordered args.
+// The result of processing is cached by the raw query, so the query is parsed only once.
+// The args of type Batch are expanded to the lists of rows, see Batch. For databases other than
+// PostgreSQL the slices are expanded to the lists of values, so `WHERE id IN (@ids)` works
+// with the field `IDs []int64` of request, the empty slice is rendered as the subquery without rows.
+// For PostgreSQL use `WHERE id = ANY(@ids)` with pq.Array instead.
+func (ctrl *Controller) ProcessQueryAndArgs(query string, reqMap RowMap) (string, []interface{}) {
+	query, _, args := ctrl.ProcessQuery(query, reqMap)
+	return query, args
+}
+
+// ProcessQuery is like ProcessQueryAndArgs but also returns the names of args
+// in the same order as args. With numbered placeholders the repeated named arg is bound once,
+// so it must be used with one type in all places of query.
+func (ctrl *Controller) ProcessQuery(query string, reqMap RowMap) (string, []string, []interface{}) {
+	pq := ctrl.processQuery(query)
+	lists := ctrl.dialect().Name() != DialectPostgreSQL.Name()
+	if expandable(pq.names, reqMap, lists) {
+		return pq.parsed.renderExpanded(ctrl.dialect(), reqMap, lists)
+	}
+	return pq.query, pq.names, bindArgs(pq.names, reqMap)
+}
+
+func (ctrl *Controller) processQuery(query string) *processedQuery {
+	if v, ok := ctrl.queries.Get(query); ok {
+		return v.(*processedQuery)
+	}
+	pq := &processedQuery{parsed: parseQuery(query, ctrl.dialect())}
+	pq.query, pq.names = pq.parsed.render(ctrl.dialect())
+	ctrl.queries.Add(query, pq)
+	return pq
 }
 
 func (ctrl *Controller) prepareStmt(ctx context.Context, qh QueryHandler, query string) (*sql.Stmt, error) {
 	var err error
 	ctx = context.WithValue(ctx, ContextKeyOperationType, OperationTypePrepare.String())
+	// the preparing is a part of the operation of method, so the info of method is kept
+	// but the type and the query are related to the preparing.
+	var info OperationInfo
+	if parent, ok := OperationFromContext(ctx); ok {
+		info = *parent
+	}
+	info.Type, info.Query, info.Args, info.ArgNames, info.StartedAt = OperationTypePrepare, query, nil, nil, time.Time{}
+	ctx = WithOperation(ctx, &info)
 	for _, fn := range ctrl.BeforeQuery {
 		var fnz FinalizerFunc
 		ctx, fnz = fn(ctx, query, nil)
@@ -339,49 +581,168 @@ func (ctrl *Controller) prepareStmt(ctx context.Context, qh QueryHandler, query
 	return stmt, nil
 }
 
+func (ctrl *Controller) findStmt(query string) *sql.Stmt {
+	return ctrl.CacheStmts.Get(query)
+}
+
 // PrepareStmt returns the prepared statements. If stmt is presented in cache then it will be returned.
 // if not, stmt will be prepared and put to cache.
+// The statement isn't acquired, so it can be closed on eviction from cache, use Stmt to execute the query.
 func (ctrl *Controller) PrepareStmt(ctx context.Context, parent QueryHandler, qh QueryHandler, query string) (*sql.Stmt, error) {
+	stmt, release, err := ctrl.acquireStmt(ctx, ctrl.CacheStmts, parent, qh, query)
+	if err != nil {
+		return nil, err
+	}
+	if release != nil {
+		release()
+	}
+	return stmt, nil
+}
+
+// acquireStmt works like PrepareStmt but keeps the prepared statements in cache.
+// The cached statement isn't closed until release is called, release is nil for the statement
+// of transaction, because it's closed with the transaction, see CloseTxStmts.
+func (ctrl *Controller) acquireStmt(ctx context.Context, cache *StmtCache, parent QueryHandler, qh QueryHandler, query string) (*sql.Stmt, func(), error) {
 	var (
-		err  error
-		stmt *sql.Stmt
+		err     error
+		stmt    *sql.Stmt
+		release func()
 	)
 
 	txOpened, _ := ctx.Value(ContextKeyTxOpened).(bool)
-	stmt = ctrl.findStmt(query)
+	stmt, release = cache.acquire(query)
 	if stmt == nil && !txOpened {
 		stmt, err = ctrl.prepareStmt(ctx, qh, query)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to prepare stmt on query %q", query)
+			return nil, nil, errors.Wrapf(err, "failed to prepare stmt on query %q", query)
 		}
-		ctrl.putStmt(query, stmt)
+		stmt, release = cache.putAcquire(query, stmt)
+	}
+	if !txOpened {
+		return stmt, release, nil
 	}
 
-	if txOpened {
-		txh, ok := qh.(*sql.Tx)
-		if !ok {
-			return nil, errors.New("failed to get transaction handler")
-		}
-		if stmt == nil {
-			if parent != nil {
-				stmt, err = ctrl.prepareStmt(ctx, parent, query)
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to prepare stmt with conn on query %q", query)
-				}
-				ctrl.putStmt(query, stmt)
-				stmt = txh.StmtContext(ctx, stmt)
-			} else {
-				stmt, err = ctrl.prepareStmt(ctx, txh, query)
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to prepare stmt with tx on query %q", query)
-				}
+	// the statement of transaction keeps the cached one until it's closed, so the cached one is released.
+	if release != nil {
+		defer release()
+	}
+	txh, ok := qh.(StmtContexter)
+	if !ok {
+		return nil, nil, errors.Errorf("failed to get transaction handler: %T doesn't implement StmtContext", qh)
+	}
+	if stmt == nil {
+		if parent != nil {
+			stmt, err = ctrl.prepareStmt(ctx, parent, query)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to prepare stmt with conn on query %q", query)
 			}
-		} else {
+			stmt, release = cache.putAcquire(query, stmt)
+			defer release()
 			stmt = txh.StmtContext(ctx, stmt)
+		} else {
+			stmt, err = ctrl.prepareStmt(ctx, qh, query)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to prepare stmt with tx on query %q", query)
+			}
 		}
+	} else {
+		stmt = txh.StmtContext(ctx, stmt)
 	}
+	ctrl.trackTxStmt(qh, stmt)
 
-	return stmt, nil
+	return stmt, nil, nil
+}
+
+// acquiredStmt is the cached statement that is released after the execution of query,
+// so it isn't closed on eviction from cache while it's used.
+type acquiredStmt struct {
+	*sql.Stmt
+	release func()
+}
+
+func (s acquiredStmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	defer s.release()
+	return s.Stmt.QueryContext(ctx, args...)
+}
+
+func (s acquiredStmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	defer s.release()
+	return s.Stmt.ExecContext(ctx, args...)
+}
+
+// stmtOf returns the Stmt of the acquired statement that is released after the execution.
+func stmtOf(stmt *sql.Stmt, release func()) Stmt {
+	if release == nil {
+		return stmt
+	}
+	return acquiredStmt{Stmt: stmt, release: release}
+}
+
+// trackTxStmt remembers the transaction-specific statement to close it
+// when the transaction is finished, see CloseTxStmts. The statements of *sql.Tx that is
+// rolled back by database/sql when the context of BeginTx is done are closed too, see trackTx.
+func (ctrl *Controller) trackTxStmt(tx interface{}, stmt *sql.Stmt) {
+	if !reflect.TypeOf(tx).Comparable() {
+		return
+	}
+	ctrl.Lock()
+	if ctrl.txStmts == nil {
+		ctrl.txStmts = make(map[interface{}][]*sql.Stmt)
+	}
+	ctrl.txStmts[tx] = append(ctrl.txStmts[tx], stmt)
+	ctrl.Unlock()
+}
+
+// CloseTxStmts closes the statements that were used in the transaction tx.
+// It's called by WrappedTx after Commit and Rollback.
+func (ctrl *Controller) CloseTxStmts(tx interface{}) {
+	if !reflect.TypeOf(tx).Comparable() {
+		return
+	}
+	ctrl.Lock()
+	stmts := ctrl.txStmts[tx]
+	delete(ctrl.txStmts, tx)
+	ctrl.Unlock()
+	for _, stmt := range stmts {
+		// the transaction is already finished, so the error of closing
+		// doesn't affect the result of operation.
+		stmt.Close()
+	}
+}
+
+// Stmt returns the Stmt to execute the query. The statement is prepared and cached with PrepareStmt
+// unless the preparing is disabled by the option SkipPrepare, then the query is executed directly on qh.
+// If qh is the Router and the operation goes to the replica then the statement is prepared on the replica.
+// If qh or parent is Shards then the statement is prepared on the shard of operation.
+func (ctrl *Controller) Stmt(ctx context.Context, parent QueryHandler, qh QueryHandler, query string) (Stmt, error) {
+	if r, ok := qh.(*Router); ok {
+		if rep := r.replicaFor(ctx); rep != nil {
+			return ctrl.replicaStmt(ctx, rep, query)
+		}
+	}
+	if s, ok := qh.(*Shards); ok {
+		shard, err := s.Shard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return ctrl.shardStmt(ctx, shard, nil, shard, query)
+	}
+	if s, ok := parent.(*Shards); ok {
+		// the statement is prepared on the shard of transaction if the operation has the key,
+		// otherwise it's prepared on the transaction itself.
+		if shard, err := s.Shard(ctx); err == nil {
+			return ctrl.shardStmt(ctx, shard, shard, qh, query)
+		}
+		parent = nil
+	}
+	if ctrl.SkipPrepare {
+		return DirectStmt(qh, query), nil
+	}
+	stmt, release, err := ctrl.acquireStmt(ctx, ctrl.CacheStmts, parent, qh, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmtOf(stmt, release), nil
 }
 
 type contextKey int
@@ -393,8 +754,75 @@ const (
 	ContextKeyOperationType
 	// ContextKeyMethodName contains the method name from user interface.
 	ContextKeyMethodName
+	// contextKeyOperation is a key of *OperationInfo value, see OperationFromContext.
+	contextKeyOperation
 )
 
+// OperationInfo describes the operation that is executing. It's stored in the context
+// by generated methods and by methods of WrappedTx before the call of BeforeQuery hooks.
+type OperationInfo struct {
+	// Interface is the name of user interface, e.g. "Store". It's empty for WrappedTx operations.
+	Interface string
+	// Method is the method name of user interface, e.g. "GetAuthors", or the method name of WrappedTx.
+	Method string
+	// Type is the type of operation.
+	Type OperationType
+	// RawQuery is the query with named args as it's returned by the request.
+	RawQuery string
+	// Query is the query with placeholders of dialect that is sent to the database.
+	Query string
+	// Args are the bound args of query.
+	Args []interface{}
+	// ArgNames are the names of args in the same order as Args. It's empty for WrappedTx operations.
+	ArgNames []string
+	// Secrets are the names of args that hold sensitive values, they are marked
+	// with the option secret of tag, `sql:"password,secret"`.
+	Secrets []string
+	// TxOpened reports whether the operation is executed in the transaction.
+	TxOpened bool
+	// Primary reports whether the request of method is PrimaryReader, see Router.
+	Primary bool
+	// ShardKey is the key of shard of the request, see Shards. It's nil if the request has no key.
+	ShardKey interface{}
+	// Tx is the transaction the operation is executed in, it's nil if TxOpened is false.
+	Tx Transaction
+	// StartedAt is the time when the operation started.
+	StartedAt time.Time
+}
+
+// IsSecret reports whether the arg with index i holds the sensitive value
+// that shouldn't be exposed, e.g. in logs.
+func (info *OperationInfo) IsSecret(i int) bool {
+	if i >= len(info.ArgNames) {
+		return false
+	}
+	for _, name := range info.Secrets {
+		if name == info.ArgNames[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// WithOperation returns the copy of ctx with the info about operation.
+// If info.StartedAt is zero then it's set to the current time.
+func WithOperation(ctx context.Context, info *OperationInfo) context.Context {
+	if info.StartedAt.IsZero() {
+		info.StartedAt = time.Now()
+	}
+	return context.WithValue(ctx, contextKeyOperation, info)
+}
+
+// OperationFromContext returns the info about operation that is stored in ctx.
+//
+//	if op, ok := sal.OperationFromContext(ctx); ok {
+//		log.Printf("%s.%s took %v", op.Interface, op.Method, time.Since(op.StartedAt))
+//	}
+func OperationFromContext(ctx context.Context) (*OperationInfo, bool) {
+	info, ok := ctx.Value(contextKeyOperation).(*OperationInfo)
+	return info, ok
+}
+
 // ClientOption sets to controller the optional parameters for clients.
 type ClientOption func(ctrl *Controller)
 
@@ -403,13 +831,117 @@ func BeforeQuery(before ...BeforeQueryFunc) ClientOption {
 	return func(ctrl *Controller) { ctrl.BeforeQuery = append(ctrl.BeforeQuery, before...) }
 }
 
-// BeforeQueryFunc is called before the query execution but after the preparing stmts.
+// WithDialect sets the Dialect of database. It defines the style of placeholders
+// in queries sent to the database.
+func WithDialect(d Dialect) ClientOption {
+	return func(ctrl *Controller) { ctrl.Dialect = d }
+}
+
+// QueryCacheSize sets the max number of processed queries that are cached by the Controller.
+// The zero size disables the cache, so the query is parsed on each call.
+func QueryCacheSize(size int) ClientOption {
+	return func(ctrl *Controller) { ctrl.queryCacheSize = size }
+}
+
+// StmtCacheSize sets the max number of prepared statements that are cached by the Controller.
+// The least recently used statement is closed when the limit is reached.
+// The zero size makes the cache unbounded.
+func StmtCacheSize(size int) ClientOption {
+	return func(ctrl *Controller) { ctrl.stmtCacheSize = size }
+}
+
+// SkipPrepare disables the preparing of statements, queries are executed directly on the QueryHandler
+// with bound args. It helps to avoid the extra round trip on the first call of method
+// and to work behind PgBouncer in transaction pooling mode.
+// To disable preparing only for particular methods see NoPreparer.
+func SkipPrepare() ClientOption {
+	return func(ctrl *Controller) { ctrl.SkipPrepare = true }
+}
+
+// AfterExec sets the AfterExecFunc that is executed after the successful Exec operation.
+func AfterExec(after ...AfterExecFunc) ClientOption {
+	return func(ctrl *Controller) { ctrl.AfterExec = append(ctrl.AfterExec, after...) }
+}
+
+// AfterQuery sets the AfterQueryFunc that is executed after the successful Query or QueryRow operation.
+func AfterQuery(after ...AfterQueryFunc) ClientOption {
+	return func(ctrl *Controller) { ctrl.AfterQuery = append(ctrl.AfterQuery, after...) }
+}
+
+// OnError sets the OnErrorFunc that is executed when the operation fails.
+func OnError(onError ...OnErrorFunc) ClientOption {
+	return func(ctrl *Controller) { ctrl.OnError = append(ctrl.OnError, onError...) }
+}
+
+// Intercept adds the interceptors to the chain of Controller. Interceptors are executed
+// in order of registration.
+func Intercept(interceptors ...Interceptor) ClientOption {
+	return func(ctrl *Controller) { ctrl.Interceptors = append(ctrl.Interceptors, interceptors...) }
+}
+
+// Operation describes the operation that is passed through the chain of interceptors.
+type Operation struct {
+	// Method is the name of method of user interface, e.g. "GetAuthors", or the name of method of WrappedTx.
+	Method string
+	// Type is the type of operation.
+	Type OperationType
+	// Query is the query with placeholders of dialect that is sent to the database.
+	Query string
+	// Args are the bound args of query.
+	Args []interface{}
+	// Request is the request of generated method, it's nil for transaction operations.
+	Request interface{}
+	// Response is the pointer to the value that is returned by the operation.
+	// Interceptor can set the value instead of execution of the operation, e.g.
+	//	*op.Response.(*[]*GetAuthorsResp) = cached
+	// For Exec operations it's a pointer to sql.Result. For streaming methods it's nil.
+	Response interface{}
+	// Handler is the handler the operation is executed on, e.g. *sql.DB or *sql.Tx.
+	// Interceptor can use it to run additional queries in the same transaction.
+	Handler QueryHandler
+}
+
+// Invoker executes the operation.
+type Invoker func(ctx context.Context, op *Operation) error
+
+// Interceptor wraps the execution of operation. It calls next to continue the execution,
+// or can skip it and set the op.Response itself, retry the call or replace the returned error.
+// Interceptor can change op.Query and op.Args before calling next.
+//
+//	func retry(ctx context.Context, op *sal.Operation, next sal.Invoker) error {
+//		err := next(ctx, op)
+//		if err != nil && op.Type == sal.OperationTypeQuery {
+//			err = next(ctx, op)
+//		}
+//		return err
+//	}
+//
+// Interceptors are called after BeforeQuery hooks and before the preparing of statement.
+type Interceptor func(ctx context.Context, op *Operation, next Invoker) error
+
+// BeforeQueryFunc is called before the query execution.
 // Returns the FinalizerFunc.
 type BeforeQueryFunc func(ctx context.Context, query string, req interface{}) (context.Context, FinalizerFunc)
 
 // FinalizerFunc is executed after the query execution.
 type FinalizerFunc func(ctx context.Context, err error)
 
+// AfterExecFunc is called after the successful Exec operation with its result,
+// so it can read RowsAffected and LastInsertId.
+type AfterExecFunc func(ctx context.Context, res sql.Result)
+
+// AfterQueryFunc is called after the successful Query or QueryRow operation with the number of scanned rows
+// and the response that is going to be returned by the method.
+// For WrappedTx.QueryContext the rows aren't scanned yet, so rows is -1 and resp is *sql.Rows.
+// For streaming methods the rows are passed to the callback, so resp is nil.
+type AfterQueryFunc func(ctx context.Context, rows int, resp interface{})
+
+// OnErrorFunc is called when the operation fails. It can translate the error,
+// e.g. sql.ErrNoRows to the error of domain, and returns the error to pass to the next OnErrorFunc.
+// The returned error is the error of the method. If nil is returned then the error is kept unchanged.
+// BeforeQuery finalizers receive the resulting error.
+type OnErrorFunc func(ctx context.Context, err error) error
+
 // OperationType is a datatype for operation types.
 type OperationType int
 
@@ -430,6 +962,8 @@ const (
 	OperationTypePrepare
 	// OperationTypeStmt is a operation of prepare statements on transaction.
 	OperationTypeStmt
+	// OperationTypeCopy is a bulk insert of rows, see Controller.CopyFrom.
+	OperationTypeCopy
 )
 
 var operationTypeNames = []string{
@@ -441,6 +975,7 @@ var operationTypeNames = []string{
 	"Rollback",
 	"Prepare",
 	"Stmt",
+	"Copy",
 }
 
 // String returns the string name of operation.
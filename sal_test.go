@@ -2,7 +2,9 @@ package sal
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 
@@ -25,6 +27,18 @@ func TestQueryArgs(t *testing.T) {
 			QueryNamed: `SELECT id, created_at, name, desc FROM authors WHERE id>@id`,
 			QueryPg:    `SELECT id, created_at, name, desc FROM authors WHERE id>$1`,
 			NamedArgs:  []string{"id"},
+		}, {
+			QueryNamed: `SELECT * FROM users WHERE email='admin@example.com' /* @note */ AND id=@id -- @tail`,
+			QueryPg:    `SELECT * FROM users WHERE email='admin@example.com' /* @note */ AND id=$1 -- @tail`,
+			NamedArgs:  []string{"id"},
+		}, {
+			QueryNamed: `SELECT $body$ @a $body$, E'\'@b', "@c" FROM t WHERE tags @> @tags::int[]`,
+			QueryPg:    `SELECT $body$ @a $body$, E'\'@b', "@c" FROM t WHERE tags @> $1::int[]`,
+			NamedArgs:  []string{"tags"},
+		}, {
+			QueryNamed: `SELECT * FROM authors WHERE a=@id OR b=@id AND c=@name AND d<>@id`,
+			QueryPg:    `SELECT * FROM authors WHERE a=$1 OR b=$1 AND c=$2 AND d<>$1`,
+			NamedArgs:  []string{"id", "name"},
 		},
 	}
 	for _, tc := range tt {
@@ -34,6 +48,182 @@ func TestQueryArgs(t *testing.T) {
 	}
 }
 
+func TestProcessQueryAndArgs(t *testing.T) {
+	rm := make(RowMap)
+	rm.AppendTo("id", 10)
+	rm.AppendTo("name", "foo")
+	query, args := ProcessQueryAndArgs(`SELECT * FROM authors WHERE a=@id OR b=@id AND c=@name`, rm)
+	assert.Equal(t, `SELECT * FROM authors WHERE a=$1 OR b=$1 AND c=$2`, query)
+	assert.Equal(t, []interface{}{10, "foo"}, args)
+}
+
+// tracedTx is a custom wrapper of transaction.
+type tracedTx struct {
+	*sql.Tx
+}
+
+func TestController_PrepareStmtCustomTx(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctrl := NewController()
+	ctx := context.WithValue(context.Background(), ContextKeyTxOpened, true)
+
+	for _, finish := range []func(tx Transaction) error{
+		func(tx Transaction) error {
+			mock.ExpectCommit()
+			return tx.Commit(ctx)
+		},
+		func(tx Transaction) error {
+			mock.ExpectRollback()
+			return tx.Rollback(ctx)
+		},
+	} {
+		mock.ExpectBegin()
+		sqlTx, err := db.Begin()
+		assert.NoError(err)
+		tx := tracedTx{sqlTx}
+
+		mock.ExpectPrepare("SELECT 1") // on connection
+		mock.ExpectPrepare("SELECT 1") // on transaction tx.Stmt
+		_, err = ctrl.PrepareStmt(ctx, db, tx, "SELECT 1")
+		assert.NoError(err)
+		mock.ExpectPrepare("SELECT 2") // on transaction
+		_, err = ctrl.PrepareStmt(ctx, nil, tx, "SELECT 2")
+		assert.NoError(err)
+		assert.Len(ctrl.txStmts[tx], 2)
+
+		assert.NoError(finish(NewWrappedTx(tx, ctrl)))
+		assert.Len(ctrl.txStmts, 0)
+		assert.NoError(ctrl.Close())
+	}
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+func TestController_Stmt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	ctrl := NewController()
+	mock.ExpectPrepare("SELECT 1")
+	stmt, err := ctrl.Stmt(ctx, nil, db, "SELECT 1")
+	assert.NoError(t, err)
+	assert.IsType(t, acquiredStmt{}, stmt)
+
+	mock.ExpectPrepare("SELECT 2").WillReturnError(errors.New("bye"))
+	_, err = ctrl.Stmt(ctx, nil, db, "SELECT 2")
+	assert.Error(t, err)
+
+	ctrl = NewController(SkipPrepare())
+	mock.ExpectExec("DELETE FROM authors").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	stmt, err = ctrl.Stmt(ctx, nil, db, "DELETE FROM authors WHERE id=$1")
+	assert.NoError(t, err)
+	_, err = stmt.ExecContext(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ctrl.CacheStmts.Len())
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestController_Close(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctrl := NewController(StmtCacheSize(1))
+	ctx := context.Background()
+
+	mock.ExpectPrepare("SELECT 1").WillBeClosed()
+	mock.ExpectPrepare("SELECT 2").WillBeClosed()
+	_, err = ctrl.PrepareStmt(ctx, nil, db, "SELECT 1")
+	assert.NoError(t, err)
+	_, err = ctrl.PrepareStmt(ctx, nil, db, "SELECT 2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ctrl.CacheStmts.Len())
+	assert.Equal(t, uint64(1), ctrl.CacheStmts.Stats().Evictions)
+
+	assert.NoError(t, ctrl.Close())
+	assert.Equal(t, 0, ctrl.CacheStmts.Len())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestController_ProcessQueryAndArgs(t *testing.T) {
+	rm := make(RowMap)
+	rm.AppendTo("id", 10)
+	rm.AppendTo("name", "foo")
+	ctrl := NewController(WithDialect(DialectMySQL))
+	query, args := ctrl.ProcessQueryAndArgs("SELECT * FROM `authors` WHERE a=@id OR b=@id AND c=@name", rm)
+	assert.Equal(t, "SELECT * FROM `authors` WHERE a=? OR b=? AND c=?", query)
+	assert.Equal(t, []interface{}{10, 10, "foo"}, args)
+}
+
+func TestController_ProcessQueryAndArgsCache(t *testing.T) {
+	rm := make(RowMap)
+	rm.AppendTo("id", 10)
+	ctrl := NewController(QueryCacheSize(1))
+	for i := 0; i < 2; i++ {
+		query, args := ctrl.ProcessQueryAndArgs(`SELECT * FROM authors WHERE id=@id`, rm)
+		assert.Equal(t, `SELECT * FROM authors WHERE id=$1`, query)
+		assert.Equal(t, []interface{}{10}, args)
+		assert.Equal(t, 1, ctrl.queries.Len())
+	}
+	query, args := ctrl.ProcessQueryAndArgs(`DELETE FROM authors WHERE id=@id`, rm)
+	assert.Equal(t, `DELETE FROM authors WHERE id=$1`, query)
+	assert.Equal(t, []interface{}{10}, args)
+	assert.Equal(t, 1, ctrl.queries.Len())
+
+	ctrl = NewController(QueryCacheSize(0))
+	query, _ = ctrl.ProcessQueryAndArgs(`SELECT * FROM authors WHERE id=@id`, rm)
+	assert.Equal(t, `SELECT * FROM authors WHERE id=$1`, query)
+	assert.Equal(t, 0, ctrl.queries.Len())
+}
+
+const benchQuery = `SELECT id, created_at, name, desc, tags FROM authors
+	WHERE id>@id AND tags @> @tags AND name <> 'admin@example.com' -- skip admin
+	ORDER BY created_at DESC LIMIT @limit`
+
+func benchRowMap() RowMap {
+	rm := make(RowMap)
+	rm.AppendTo("id", 10)
+	rm.AppendTo("tags", []int64{1, 2, 3})
+	rm.AppendTo("limit", 100)
+	return rm
+}
+
+func BenchmarkProcessQueryAndArgs(b *testing.B) {
+	rm := benchRowMap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ProcessQueryAndArgs(benchQuery, rm)
+	}
+}
+
+func BenchmarkController_ProcessQueryAndArgs(b *testing.B) {
+	rm := benchRowMap()
+	ctrl := NewController()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctrl.ProcessQueryAndArgs(benchQuery, rm)
+	}
+}
+
+func BenchmarkController_ProcessQueryAndArgsNoCache(b *testing.B) {
+	rm := benchRowMap()
+	ctrl := NewController(QueryCacheSize(0))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctrl.ProcessQueryAndArgs(benchQuery, rm)
+	}
+}
+
 func TestMapIndex_NextVal(t *testing.T) {
 	ind := make(mapIndex)
 	assert.Equal(t, 0, ind.NextVal("foo"))
@@ -144,3 +334,213 @@ func TestController_PrepareStmt(t *testing.T) {
 
 	assert.Nil(mock.ExpectationsWereMet())
 }
+
+func TestWrappedTx_Hooks(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var (
+		affected int64
+		rowsCnt  int
+		errs     []error
+	)
+	errCommit := errors.New("commit failed")
+	ctrl := NewController(
+		AfterExec(func(ctx context.Context, res sql.Result) { affected, _ = res.RowsAffected() }),
+		AfterQuery(func(ctx context.Context, rows int, resp interface{}) { rowsCnt = rows }),
+		OnError(func(ctx context.Context, err error) error {
+			errs = append(errs, err)
+			return errors.Wrap(err, ctx.Value(ContextKeyOperationType).(string))
+		}),
+	)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	sqlTx, err := db.Begin()
+	assert.NoError(err)
+	tx := NewWrappedTx(sqlTx, ctrl)
+
+	mock.ExpectExec("DELETE FROM authors").WillReturnResult(sqlmock.NewResult(0, 5))
+	_, err = tx.ExecContext(ctx, "DELETE FROM authors")
+	assert.NoError(err)
+	assert.Equal(int64(5), affected)
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := tx.QueryContext(ctx, "SELECT 1")
+	assert.NoError(err)
+	assert.NoError(rows.Close())
+	assert.Equal(-1, rowsCnt)
+
+	mock.ExpectCommit().WillReturnError(errCommit)
+	err = tx.Commit(ctx)
+	assert.EqualError(err, "Commit: commit failed")
+	assert.Equal([]error{errCommit}, errs)
+
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+func TestController_Invoke(t *testing.T) {
+	assert := assert.New(t)
+	var calls []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, op *Operation, next Invoker) error {
+			calls = append(calls, name+":before")
+			err := next(ctx, op)
+			calls = append(calls, name+":after")
+			return err
+		}
+	}
+	ctrl := NewController(Intercept(trace("first"), trace("second")))
+
+	err := ctrl.Invoke(context.Background(), &Operation{}, func(ctx context.Context, op *Operation) error {
+		calls = append(calls, "invoker")
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"first:before", "second:before", "invoker", "second:after", "first:after"}, calls)
+}
+
+func TestWrappedTx_Intercept(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var ops []string
+	ctrl := NewController(Intercept(func(ctx context.Context, op *Operation, next Invoker) error {
+		ops = append(ops, op.Method)
+		if op.Type == OperationTypeExec {
+			op.Query += " WHERE archived"
+		}
+		return next(ctx, op)
+	}))
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	sqlTx, err := db.Begin()
+	assert.NoError(err)
+	tx := NewWrappedTx(sqlTx, ctrl)
+
+	mock.ExpectExec("DELETE FROM authors WHERE archived").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = tx.ExecContext(ctx, "DELETE FROM authors")
+	assert.NoError(err)
+
+	mock.ExpectCommit()
+	assert.NoError(tx.Commit(ctx))
+	assert.Equal([]string{"ExecContext", "Commit"}, ops)
+
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+func TestOperationFromContext(t *testing.T) {
+	assert := assert.New(t)
+	_, ok := OperationFromContext(context.Background())
+	assert.False(ok)
+
+	started := time.Now().Add(-time.Second)
+	ctx := WithOperation(context.Background(), &OperationInfo{Method: "GetAuthors", StartedAt: started})
+	info, ok := OperationFromContext(ctx)
+	assert.True(ok)
+	assert.Equal("GetAuthors", info.Method)
+	assert.Equal(started, info.StartedAt)
+
+	ctx = WithOperation(context.Background(), &OperationInfo{})
+	info, _ = OperationFromContext(ctx)
+	assert.False(info.StartedAt.IsZero())
+}
+
+func TestWrappedTx_OperationInfo(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var infos []OperationInfo
+	ctrl := NewController(BeforeQuery(func(ctx context.Context, query string, req interface{}) (context.Context, FinalizerFunc) {
+		info, ok := OperationFromContext(ctx)
+		assert.True(ok)
+		infos = append(infos, *info)
+		return ctx, nil
+	}))
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	sqlTx, err := db.Begin()
+	assert.NoError(err)
+	tx := NewWrappedTx(sqlTx, ctrl)
+
+	mock.ExpectExec("DELETE FROM authors").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = tx.ExecContext(ctx, "DELETE FROM authors WHERE id=$1", 1)
+	assert.NoError(err)
+
+	mock.ExpectRollback()
+	assert.NoError(tx.Rollback(ctx))
+
+	if assert.Len(infos, 2) {
+		assert.Equal("ExecContext", infos[0].Method)
+		assert.Equal(OperationTypeExec, infos[0].Type)
+		assert.Equal("DELETE FROM authors WHERE id=$1", infos[0].Query)
+		assert.Equal([]interface{}{1}, infos[0].Args)
+		assert.True(infos[0].TxOpened)
+		assert.Equal("Rollback", infos[1].Method)
+		assert.Equal(OperationTypeRollback, infos[1].Type)
+	}
+
+	assert.Nil(mock.ExpectationsWereMet())
+}
+
+func TestController_ProcessQuery(t *testing.T) {
+	ctrl := NewController()
+	reqMap := RowMap{"login": []interface{}{"foo"}, "password": []interface{}{"bar"}}
+	query, names, args := ctrl.ProcessQuery(`SELECT * FROM users WHERE login=@login AND password=@password`, reqMap)
+	assert.Equal(t, `SELECT * FROM users WHERE login=$1 AND password=$2`, query)
+	assert.Equal(t, []string{"login", "password"}, names)
+	assert.Equal(t, []interface{}{"foo", "bar"}, args)
+}
+
+func TestOperationInfo_IsSecret(t *testing.T) {
+	info := &OperationInfo{
+		Args:     []interface{}{"foo", "bar", "baz"},
+		ArgNames: []string{"login", "password", "login"},
+		Secrets:  []string{"password"},
+	}
+	assert.False(t, info.IsSecret(0))
+	assert.True(t, info.IsSecret(1))
+	assert.False(t, info.IsSecret(2))
+	assert.False(t, (&OperationInfo{Args: []interface{}{"foo"}}).IsSecret(0))
+}
+
+func TestWrappedTx_Callbacks(t *testing.T) {
+	assert := assert.New(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctrl := NewController()
+	ctx := context.Background()
+
+	var events []string
+	mock.ExpectBegin()
+	sqlTx, err := db.Begin()
+	assert.NoError(err)
+	NewWrappedTx(sqlTx, ctrl).AfterCommit(func(ctx context.Context) { events = append(events, "commit") })
+	NewWrappedTx(sqlTx, ctrl).AfterRollback(func(ctx context.Context) { events = append(events, "rollback") })
+
+	mock.ExpectCommit().WillReturnError(errors.New("could not serialize access"))
+	assert.Error(NewWrappedTx(sqlTx, ctrl).Commit(ctx))
+	assert.Equal([]string{"rollback"}, events)
+
+	assert.Equal(sql.ErrTxDone, NewWrappedTx(sqlTx, ctrl).Rollback(ctx))
+	assert.Equal([]string{"rollback"}, events)
+
+	assert.Nil(mock.ExpectationsWereMet())
+}
@@ -21,11 +21,23 @@ const (
 const (
 	MethodNameTx      string = "Tx"
 	MethodNameBeginTx string = "BeginTx"
+	MethodNameRunInTx string = "RunInTx"
 )
 
+// dialects maps the names of dialects accepted by flag -dialect
+// to the names of variables in package sal.
+var dialects = map[string]string{
+	"postgres":  "DialectPostgreSQL",
+	"mysql":     "DialectMySQL",
+	"sqlite":    "DialectSQLite",
+	"sqlserver": "DialectSQLServer",
+	"oracle":    "DialectOracle",
+}
+
 type generator struct {
-	buf    bytes.Buffer
-	indent string
+	buf     bytes.Buffer
+	indent  string
+	dialect string
 }
 
 func (g *generator) Generate(pkg *looker.Package, dstPkg looker.ImportElement) error {
@@ -69,6 +81,9 @@ func (g *generator) GenerateInterface(dstPkg looker.ImportElement, intf *looker.
 	g.p("}")
 
 	g.p("func New%v(h sal.QueryHandler, options ...sal.ClientOption) *%v {", intf.UserType, implName)
+	if g.dialect != "" && g.dialect != sal.DialectPostgreSQL.Name() {
+		g.p("options = append([]sal.ClientOption{sal.WithDialect(sal.%s)}, options...)", dialects[g.dialect])
+	}
 	g.p("s := &%s{", implName)
 	g.p("handler: h,")
 	g.p("ctrl: sal.NewController(options...),")
@@ -82,9 +97,11 @@ func (g *generator) GenerateInterface(dstPkg looker.ImportElement, intf *looker.
 	g.GenerateBeginTx(dstPkg, intf)
 	g.br()
 	g.GenerateTx(dstPkg, intf)
+	g.br()
+	g.GenerateRunInTx(dstPkg, intf)
 
 	for _, mtd := range intf.Methods {
-		if err := g.GenerateMethod(dstPkg, implName, mtd); err != nil {
+		if err := g.GenerateMethod(dstPkg, intf, mtd); err != nil {
 			return err
 		}
 		g.br()
@@ -99,11 +116,24 @@ func (pa prmArgs) String() string {
 	return strings.Join(pa, ",")
 }
 
-func (g *generator) GenerateMethod(dstPkg looker.ImportElement, implName string, mtd *looker.Method) error {
+func (g *generator) GenerateMethod(dstPkg looker.ImportElement, intf *looker.Interface, mtd *looker.Method) error {
 	switch mtd.Name {
-	case MethodNameBeginTx, MethodNameTx:
+	case MethodNameBeginTx, MethodNameTx, MethodNameRunInTx:
 		return nil
 	}
+	if items, ok := copyItems(mtd); ok {
+		return g.GenerateCopyMethod(dstPkg, intf, mtd, items)
+	}
+	if fn, ok := rowsCallback(mtd); ok {
+		if fn.In[0].Kind() == reflect.Slice.String() {
+			if g.dialect != "" && g.dialect != sal.DialectPostgreSQL.Name() {
+				return errors.Errorf("method %s.%s: server-side cursors are supported only by dialect postgres, not %s",
+					intf.UserType, mtd.Name, g.dialect)
+			}
+			return g.GenerateCursorMethod(dstPkg, intf, mtd, fn)
+		}
+		return g.GenerateStreamMethod(dstPkg, intf, mtd, fn)
+	}
 
 	inArgs := make(prmArgs, 0, 2)
 	inArgs = append(inArgs, "ctx "+mtd.In[0].Name(dstPkg.Path))
@@ -124,65 +154,71 @@ func (g *generator) GenerateMethod(dstPkg looker.ImportElement, implName string,
 	}
 	outArgs = append(outArgs, mtd.Out[len(mtd.Out)-1].Name(dstPkg.Path))
 
-	g.p("func (s *%v) %v(%v) (%v) {", implName, mtd.Name, inArgs.String(), outArgs.String())
-	g.p("var (")
-	g.p("err error")
-	g.p("rawQuery = req.Query()")
-	g.p("reqMap = make(sal.RowMap)")
-	g.p(")")
-	g.GenerateRowMap(req, "reqMap", "req")
-
-	g.p("ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)")
-	g.p("ctx = context.WithValue(ctx, sal.ContextKeyOperationType, %q)", operation.String())
-	g.p("ctx = context.WithValue(ctx, sal.ContextKeyMethodName, %q)", mtd.Name)
-	g.br()
+	var errRespStr = responseErrStr(operation, resp, dstPkg.Path)
+	if operation == sal.OperationTypeExec && isSqlResult(resp) {
+		errRespStr = "nil"
+	}
 
-	g.p("pgQuery, args := sal.ProcessQueryAndArgs(rawQuery, reqMap)")
-	g.br()
+	batch, withBatch, err := batchField(req)
+	if err != nil {
+		return err
+	}
 
-	var errRespStr = responseErrStr(operation, resp, dstPkg.Path)
+	g.p("func (s *%v) %v(%v) (%v) {", intf.ImplementationName(Prefix), mtd.Name, inArgs.String(), outArgs.String())
+	if withBatch {
+		g.GenerateBatchChunks(dstPkg, intf, mtd, batch, operation, errRespStr)
+	}
+	g.methodPrologue(intf, mtd, req, operation)
 
-	g.p("stmt, err := s.ctrl.PrepareStmt(ctx, s.parent, s.handler, pgQuery)")
-	g.p("if err != nil {")
+	var respRow looker.Parameter
+	var respVar string
 	switch operation {
-	case sal.OperationTypeQuery, sal.OperationTypeQueryRow:
-		g.p("return %s, errors.WithStack(err)", errRespStr)
+	case sal.OperationTypeQuery:
+		respVar = "list"
+		respRow = resp.(*looker.SliceElement).Item
+		g.p("var list = make(%s, 0)", resp.Name(dstPkg.Path))
+	case sal.OperationTypeQueryRow:
+		respVar = "resp"
+		respRow = resp
+		g.p("var resp %s", respRow.Name(dstPkg.Path))
 	case sal.OperationTypeExec:
-		if isSqlResult(mtd.Out[0]) {
-			g.p("return nil, errors.WithStack(err)")
-		} else {
-			g.p("return errors.WithStack(err)")
-		}
+		respVar = "res"
+		g.p("var res sql.Result")
 	}
+	g.p("op := &sal.Operation{")
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("Query: query,")
+	g.p("Args: args,")
+	g.p("Request: req,")
+	g.p("Response: &%s,", respVar)
+	g.p("Handler: s.handler,")
 	g.p("}")
-	g.br()
+	g.p("err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {")
+	if operation == sal.OperationTypeExec {
+		g.p("var err error")
+	}
 
-	g.beforeQueryHook("rawQuery", "req")
+	if isNoPreparer(req) {
+		g.p("stmt := sal.DirectStmt(s.handler, op.Query)")
+	} else {
+		g.p("stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)")
+		g.p("if err != nil {")
+		g.p("return errors.WithStack(err)")
+		g.p("}")
+	}
 	g.br()
 
-	switch operation {
-	case sal.OperationTypeQuery, sal.OperationTypeQueryRow:
-		g.p("rows, err := stmt.QueryContext(ctx, args...)")
-		g.ifErr(errRespStr, "failed to execute Query")
-		g.p("defer rows.Close()")
+	if operation == sal.OperationTypeExec {
+		g.p("res, err = stmt.ExecContext(ctx, op.Args...)")
+		g.ifErr("failed to execute Exec")
 		g.br()
-
-		g.p("cols, err := rows.Columns()")
-		g.ifErr(errRespStr, "failed to fetch columns")
+		g.p("s.ctrl.HandleExecResult(ctx, res)")
 		g.br()
-	case sal.OperationTypeExec:
-		if isSqlResult(mtd.Out[0]) {
-			g.p("res, err := stmt.ExecContext(ctx, args...)")
-			g.ifErr("nil", "failed to execute Exec")
-		} else {
-			g.p("_, err = stmt.ExecContext(ctx, args...)")
-			g.ifErr("", "failed to execute Exec")
-		}
-
+		g.p("return nil")
+		g.p("})")
+		g.ifErrReturn(errRespStr)
 		g.br()
-	}
-
-	if operation == sal.OperationTypeExec {
 		if isSqlResult(mtd.Out[0]) {
 			g.p("return res, nil")
 		} else {
@@ -192,29 +228,30 @@ func (g *generator) GenerateMethod(dstPkg looker.ImportElement, implName string,
 		return nil
 	}
 
+	g.p("rows, err := stmt.QueryContext(ctx, op.Args...)")
+	g.ifErr("failed to execute Query")
+	g.p("defer rows.Close()")
+	g.br()
+
+	g.p("cols, err := rows.Columns()")
+	g.ifErr("failed to fetch columns")
+	g.br()
+
 	if operation == sal.OperationTypeQueryRow {
 		g.p("if !rows.Next() {")
 		g.p("if err = rows.Err(); err != nil {")
-		g.p("return %s, errors.Wrap(err, %q)", errRespStr, "rows error")
+		g.p("return errors.Wrap(err, %q)", "rows error")
 		g.p("}")
-		g.p("return %s, sql.ErrNoRows", errRespStr)
+		g.p("return sql.ErrNoRows")
 		g.p("}")
 		g.br()
 	}
 
-	var respRow looker.Parameter
+	var respRowStr = "resp"
 	if operation == sal.OperationTypeQuery {
-		g.p("var list = make(%s, 0)", resp.Name(dstPkg.Path))
-		g.br()
 		g.p("for rows.Next() {")
-		respSlice := resp.(*looker.SliceElement)
-
-		respRow = respSlice.Item
-	} else {
-		respRow = resp
+		g.p("var %s %s", respRowStr, respRow.Name(dstPkg.Path))
 	}
-	var respRowStr = "resp"
-	g.p("var %s %s", respRowStr, respRow.Name(dstPkg.Path))
 	g.p("var respMap = make(sal.RowMap)")
 	g.GenerateRowMap(respRow, "respMap", "resp")
 
@@ -222,7 +259,7 @@ func (g *generator) GenerateMethod(dstPkg looker.ImportElement, implName string,
 	g.br()
 
 	g.p("if err = rows.Scan(dest...); err != nil {")
-	g.p("return %s, errors.Wrap(err, %q)", errRespStr, "failed to scan row")
+	g.p("return errors.Wrap(err, %q)", "failed to scan row")
 	g.p("}")
 	if operation == sal.OperationTypeQuery {
 		if respRow.Pointer() {
@@ -235,29 +272,526 @@ func (g *generator) GenerateMethod(dstPkg looker.ImportElement, implName string,
 	g.br()
 
 	g.p("if err = rows.Err(); err != nil {")
-	g.p("return %s, errors.Wrap(err, %q)", errRespStr, "something failed during iteration")
+	g.p("return errors.Wrap(err, %q)", "something failed during iteration")
 	g.p("}")
 	g.br()
 
-	respStr := "resp"
+	respStr := respVar
+	rowsCount := "1"
 	if operation == sal.OperationTypeQuery {
-		respStr = "list"
+		rowsCount = "len(list)"
 	}
-
 	if resp.Pointer() {
 		respStr = "&" + respStr
 	}
 
+	g.p("s.ctrl.HandleQueryResult(ctx, %s, %s)", rowsCount, respStr)
+	g.br()
+	g.p("return nil")
+	g.p("})")
+	g.ifErrReturn(errRespStr)
+	g.br()
 	g.p("return %s, nil", respStr)
 	g.p("}")
 
 	return nil
 }
 
+// GenerateStreamMethod generates the method that passes the scanned rows to the callback one by one
+// instead of collecting them to the list:
+//
+//	GetAuthorsEach(ctx context.Context, req GetAuthorsReq, fn func(*GetAuthorsResp) error) error
+//
+// The iteration stops on the error of callback, the cancellation of context or sal.ErrStopIteration
+// returned by the callback, the rows are closed in any case.
+func (g *generator) GenerateStreamMethod(dstPkg looker.ImportElement, intf *looker.Interface, mtd *looker.Method, fn *looker.FuncElement) error {
+	req := mtd.In[1]
+	respRow := fn.In[0]
+	operation := sal.OperationTypeQuery
+
+	g.p("func (s *%v) %v(ctx %s, req %s, callback %s) error {",
+		intf.ImplementationName(Prefix), mtd.Name,
+		mtd.In[0].Name(dstPkg.Path), elementType(req.Pointer(), req.Name(dstPkg.Path)), fn.Name(dstPkg.Path),
+	)
+	g.methodPrologue(intf, mtd, req, operation)
+
+	g.p("op := &sal.Operation{")
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("Query: query,")
+	g.p("Args: args,")
+	g.p("Request: req,")
+	g.p("Handler: s.handler,")
+	g.p("}")
+	g.p("err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {")
+	if isNoPreparer(req) {
+		g.p("stmt := sal.DirectStmt(s.handler, op.Query)")
+	} else {
+		g.p("stmt, err := s.ctrl.Stmt(ctx, s.parent, s.handler, op.Query)")
+		g.p("if err != nil {")
+		g.p("return errors.WithStack(err)")
+		g.p("}")
+	}
+	g.br()
+
+	g.p("rows, err := stmt.QueryContext(ctx, op.Args...)")
+	g.ifErr("failed to execute Query")
+	g.p("defer rows.Close()")
+	g.br()
+
+	g.p("cols, err := rows.Columns()")
+	g.ifErr("failed to fetch columns")
+	g.br()
+
+	g.p("var count int")
+	g.p("for rows.Next() {")
+	g.p("if err = ctx.Err(); err != nil {")
+	g.p("return errors.Wrap(err, %q)", "iteration is interrupted")
+	g.p("}")
+	g.scanRow(dstPkg, respRow, "")
+	g.p("count++")
+	g.br()
+
+	respRowStr := "resp"
+	if respRow.Pointer() {
+		respRowStr = "&resp"
+	}
+	g.p("if err = callback(%s); err != nil {", respRowStr)
+	g.p("if err == sal.ErrStopIteration {")
+	g.p("break")
+	g.p("}")
+	g.p("return err")
+	g.p("}")
+	g.p("}")
+	g.br()
+
+	g.p("if err = rows.Err(); err != nil {")
+	g.p("return errors.Wrap(err, %q)", "something failed during iteration")
+	g.p("}")
+	g.br()
+
+	g.p("s.ctrl.HandleQueryResult(ctx, count, nil)")
+	g.br()
+	g.p("return nil")
+	g.p("})")
+	g.ifErrReturn("")
+	g.br()
+	g.p("return nil")
+	g.p("}")
+
+	return nil
+}
+
+// GenerateCursorMethod generates the method that reads the result of query with the server-side cursor
+// and passes the rows to the callback by batches:
+//
+//	ExportAuthors(ctx context.Context, req ExportAuthorsReq, fn func([]*GetAuthorsResp) error) error
+//
+// The cursor exists only in the transaction, so the method starts the transaction with BeginTx
+// if it's called outside of one. The size of batch is defined by sal.FetchSizeOf.
+func (g *generator) GenerateCursorMethod(dstPkg looker.ImportElement, intf *looker.Interface, mtd *looker.Method, fn *looker.FuncElement) error {
+	req := mtd.In[1]
+	list := fn.In[0].(*looker.SliceElement)
+	respRow := list.Item
+	operation := sal.OperationTypeQuery
+
+	g.p("func (s *%v) %v(ctx %s, req %s, callback %s) error {",
+		intf.ImplementationName(Prefix), mtd.Name,
+		mtd.In[0].Name(dstPkg.Path), elementType(req.Pointer(), req.Name(dstPkg.Path)), fn.Name(dstPkg.Path),
+	)
+	g.p("// the cursor exists only in the transaction.")
+	g.p("if !s.txOpened {")
+	g.p("client, err := s.BeginTx(ctx, nil)")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("return sal.RunTx(ctx, client.(*%s).Tx(), func() error {", intf.ImplementationName(Prefix))
+	g.p("return client.%s(ctx, req, callback)", mtd.Name)
+	g.p("})")
+	g.p("}")
+	g.br()
+	g.methodPrologue(intf, mtd, req, operation)
+
+	reqPtr := "&req"
+	if req.Pointer() {
+		reqPtr = "req"
+	}
+	g.p("op := &sal.Operation{")
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("Query: query,")
+	g.p("Args: args,")
+	g.p("Request: req,")
+	g.p("Handler: s.handler,")
+	g.p("}")
+	g.p("err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {")
+	g.p("cur, err := sal.DeclareCursor(ctx, s.handler, op.Query, op.Args...)")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.br()
+
+	g.p("scan := func(rows *sql.Rows) (%s, error) {", list.Name(dstPkg.Path))
+	g.p("defer rows.Close()")
+	g.br()
+	g.p("cols, err := rows.Columns()")
+	g.p("if err != nil {")
+	g.p("return nil, errors.Wrap(err, %q)", "failed to fetch columns")
+	g.p("}")
+	g.br()
+	g.p("var list = make(%s, 0)", list.Name(dstPkg.Path))
+	g.p("for rows.Next() {")
+	g.scanRow(dstPkg, respRow, "nil, ")
+	respRowStr := "resp"
+	if respRow.Pointer() {
+		respRowStr = "&resp"
+	}
+	g.br()
+	g.p("list = append(list, %s)", respRowStr)
+	g.p("}")
+	g.br()
+	g.p("if err = rows.Err(); err != nil {")
+	g.p("return nil, errors.Wrap(err, %q)", "something failed during iteration")
+	g.p("}")
+	g.br()
+	g.p("return list, nil")
+	g.p("}")
+	g.br()
+
+	g.p("var (")
+	g.p("count int")
+	g.p("size = sal.FetchSizeOf(%s)", reqPtr)
+	g.p(")")
+	g.p("for {")
+	g.p("rows, err := cur.Fetch(ctx, size)")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("list, err := scan(rows)")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("if len(list) == 0 {")
+	g.p("break")
+	g.p("}")
+	g.p("count += len(list)")
+	g.br()
+	g.p("if err = callback(list); err != nil {")
+	g.p("if err == sal.ErrStopIteration {")
+	g.p("break")
+	g.p("}")
+	g.p("return err")
+	g.p("}")
+	g.p("if len(list) < size {")
+	g.p("break")
+	g.p("}")
+	g.p("}")
+	g.br()
+
+	g.p("if err = cur.Close(ctx); err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.br()
+	g.p("s.ctrl.HandleQueryResult(ctx, count, nil)")
+	g.br()
+	g.p("return nil")
+	g.p("})")
+	g.ifErrReturn("")
+	g.br()
+	g.p("return nil")
+	g.p("}")
+
+	return nil
+}
+
+// GenerateCopyMethod generates the method that inserts the slice of structs with COPY FROM,
+// or with batches of multi-row INSERT if COPY isn't supported, see sal.Controller.CopyFrom:
+//
+//	CopyBooks(ctx context.Context, req []*Book) (int64, error)
+//
+// The columns are the fields of struct, the table is returned by the method TableName of struct.
+// The rows are inserted in the transaction, so the method starts the transaction with BeginTx
+// if it's called outside of one.
+func (g *generator) GenerateCopyMethod(dstPkg looker.ImportElement, intf *looker.Interface, mtd *looker.Method, items *looker.SliceElement) error {
+	req := mtd.In[1]
+	item := items.Item.(*looker.StructElement)
+	if !item.TableNamer {
+		return errors.Errorf("method %s.%s: item %s of copy method doesn't implement sal.TableNamer",
+			intf.UserType, mtd.Name, item.Name(dstPkg.Path))
+	}
+	if len(item.Fields) == 0 {
+		return errors.Errorf("method %s.%s: item %s of copy method has no fields mapped to columns",
+			intf.UserType, mtd.Name, item.Name(dstPkg.Path))
+	}
+	withCount := len(mtd.Out) == 2
+	errResp := ""
+	if withCount {
+		errResp = "0"
+	}
+	operation := sal.OperationTypeCopy
+
+	outArgs := "error"
+	if withCount {
+		outArgs = "(int64, error)"
+	}
+	g.p("func (s *%v) %v(ctx %s, req %s) %s {",
+		intf.ImplementationName(Prefix), mtd.Name,
+		mtd.In[0].Name(dstPkg.Path), elementType(req.Pointer(), req.Name(dstPkg.Path)), outArgs,
+	)
+	g.p("// the rows are inserted in the transaction.")
+	res := ""
+	if withCount {
+		res = "n"
+	}
+	g.callInTx(intf, mtd.Name+"(ctx, req)", res, "int64", errResp)
+	g.br()
+
+	cols := make([]string, 0, len(item.Fields))
+	for _, field := range item.Fields {
+		cols = append(cols, field.ColumnName())
+	}
+	g.p("var (")
+	g.p("err error")
+	g.p("n int64")
+	g.p("table = new(%s).TableName()", item.Name(dstPkg.Path))
+	g.p("cols = %#v", cols)
+	g.p("rows = make([][]interface{}, 0, len(req))")
+	g.p(")")
+	g.itemValues(item, "req", "rows", "cols")
+	g.br()
+
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)")
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyOperationType, %q)", operation.String())
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyMethodName, %q)", mtd.Name)
+	g.br()
+
+	g.p("query := s.ctrl.CopyQuery(table, cols)")
+	g.p("ctx = sal.WithOperation(ctx, &sal.OperationInfo{")
+	g.p("Interface: %q,", intf.UserType)
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("RawQuery: query,")
+	g.p("Query: query,")
+	g.p("TxOpened: s.txOpened,")
+	g.p("Tx: s.Tx(),")
+	g.p("})")
+	g.br()
+
+	g.beforeQueryHook("query", "req")
+	g.br()
+
+	g.p("op := &sal.Operation{")
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("Query: query,")
+	g.p("Request: req,")
+	g.p("Response: &n,")
+	g.p("Handler: s.handler,")
+	g.p("}")
+	g.p("err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {")
+	g.p("var err error")
+	g.p("n, err = s.ctrl.CopyFrom(ctx, s.handler, table, cols, rows)")
+	g.p("return err")
+	g.p("})")
+	g.ifErrReturn(errResp)
+	g.br()
+	if withCount {
+		g.p("return n, nil")
+	} else {
+		g.p("return nil")
+	}
+	g.p("}")
+
+	return nil
+}
+
+// callInTx generates the call of method in the transaction that is started with BeginTx
+// if the method is called outside of one. The result of call is kept in the variable res
+// of type resType, res is empty if the method returns only error.
+func (g *generator) callInTx(intf *looker.Interface, call string, res string, resType string, errResp string) {
+	g.p("if !s.txOpened {")
+	g.p("client, err := s.BeginTx(ctx, nil)")
+	g.p("if err != nil {")
+	g.p("return %s", errList(errResp, "err"))
+	g.p("}")
+	if res != "" {
+		g.p("var %s %s", res, resType)
+	}
+	g.p("err = sal.RunTx(ctx, client.(*%s).Tx(), func() error {", intf.ImplementationName(Prefix))
+	if res != "" {
+		g.p("var err error")
+		g.p("%s, err = client.%s", res, call)
+		g.p("return err")
+	} else {
+		g.p("return client.%s", call)
+	}
+	g.p("})")
+	g.p("return %s", errList(res, "err"))
+	g.p("}")
+}
+
+// itemValues generates the loop that converts the structs of slice src to the rows of values
+// in order of cols and appends the rows to dst.
+func (g *generator) itemValues(item *looker.StructElement, src string, dst string, cols string) {
+	g.p("for _, item := range %s {", src)
+	g.p("item := item")
+	g.p("var rowMap = make(sal.RowMap)")
+	g.GenerateRowMap(item, "rowMap", "item")
+	g.p("%s = append(%s, rowMap.Values(%s))", dst, dst, cols)
+	g.p("}")
+}
+
+// errList returns the list of values to return with the error.
+func errList(resp string, err string) string {
+	if resp == "" {
+		return err
+	}
+	return resp + ", " + err
+}
+
+// copyItems returns the slice of structs that is the request of copy method.
+// The copy method returns the number of inserted rows and error or only error.
+func copyItems(mtd *looker.Method) (*looker.SliceElement, bool) {
+	if len(mtd.In) != 2 {
+		return nil, false
+	}
+	items, ok := mtd.In[1].(*looker.SliceElement)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := items.Item.(*looker.StructElement); !ok {
+		return nil, false
+	}
+	switch len(mtd.Out) {
+	case 1:
+		return items, true
+	case 2:
+		return items, mtd.Out[0].Name("") == "int64"
+	}
+	return nil, false
+}
+
+// scanRow generates the scanning of the current row of rows to the new variable resp.
+// The error of scanning is returned after the values listed in errPrefix, e.g. "nil, ".
+func (g *generator) scanRow(dstPkg looker.ImportElement, respRow looker.Parameter, errPrefix string) {
+	g.p("var resp %s", respRow.Name(dstPkg.Path))
+	g.p("var respMap = make(sal.RowMap)")
+	g.GenerateRowMap(respRow, "respMap", "resp")
+
+	g.p("dest := sal.GetDests(cols, respMap)")
+	g.br()
+
+	g.p("if err = rows.Scan(dest...); err != nil {")
+	g.p("return %serrors.Wrap(err, %q)", errPrefix, "failed to scan row")
+	g.p("}")
+}
+
+// rowsCallback returns the callback of streaming or cursor method, that is the last parameter
+// of func type that receives the struct or the slice of structs and returns error.
+func rowsCallback(mtd *looker.Method) (*looker.FuncElement, bool) {
+	if len(mtd.In) != 3 || len(mtd.Out) != 1 {
+		return nil, false
+	}
+	fn, ok := mtd.In[2].(*looker.FuncElement)
+	if !ok || len(fn.In) != 1 || len(fn.Out) != 1 || fn.Out[0].Name("") != "error" {
+		return nil, false
+	}
+	row := fn.In[0]
+	if sl, ok := row.(*looker.SliceElement); ok {
+		row = sl.Item
+	}
+	if row.Kind() != reflect.Struct.String() {
+		return nil, false
+	}
+	return fn, true
+}
+
+// methodPrologue generates the beginning of method: the processing of request and query,
+// the info of operation and the call of BeforeQuery hooks.
+func (g *generator) methodPrologue(intf *looker.Interface, mtd *looker.Method, req looker.Parameter, operation sal.OperationType) {
+	g.p("var (")
+	g.p("err error")
+	g.p("rawQuery = req.Query()")
+	g.p("reqMap = make(sal.RowMap)")
+	g.p(")")
+	g.GenerateRowMap(req, "reqMap", "req")
+
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)")
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyOperationType, %q)", operation.String())
+	g.p("ctx = context.WithValue(ctx, sal.ContextKeyMethodName, %q)", mtd.Name)
+	g.br()
+
+	g.p("query, names, args := s.ctrl.ProcessQuery(rawQuery, reqMap)")
+	g.p("ctx = sal.WithOperation(ctx, &sal.OperationInfo{")
+	g.p("Interface: %q,", intf.UserType)
+	g.p("Method: %q,", mtd.Name)
+	g.p("Type: sal.OperationType%s,", operation.String())
+	g.p("RawQuery: rawQuery,")
+	g.p("Query: query,")
+	g.p("Args: args,")
+	g.p("ArgNames: names,")
+	if secrets := secretColumns(req); len(secrets) > 0 {
+		g.p("Secrets: %#v,", secrets)
+	}
+	g.p("TxOpened: s.txOpened,")
+	if isPrimaryReader(req) {
+		g.p("Primary: true,")
+	}
+	if key := shardKey(req, "req"); key != "" {
+		g.p("ShardKey: %s,", key)
+	}
+	g.p("Tx: s.Tx(),")
+	g.p("})")
+	g.br()
+
+	g.beforeQueryHook("rawQuery", "req")
+	g.br()
+}
+
+// secretColumns returns the column names of fields of request that are marked as secret.
+func secretColumns(prm looker.Parameter) []string {
+	st, ok := prm.(*looker.StructElement)
+	if !ok {
+		return nil
+	}
+	var secrets []string
+	for _, field := range st.Fields {
+		if field.Secret {
+			secrets = append(secrets, field.ColumnName())
+		}
+		if field.Batch != nil {
+			secrets = append(secrets, secretColumns(field.Batch)...)
+		}
+	}
+	return secrets
+}
+
+// shardKey returns the expression of the key of shard of request or the empty string
+// if the request has no key.
+func shardKey(prm looker.Parameter, prmName string) string {
+	st, ok := prm.(*looker.StructElement)
+	if !ok {
+		return ""
+	}
+	if st.ShardKeyer {
+		return prmName + ".ShardKey()"
+	}
+	for _, field := range st.Fields {
+		if field.Shard {
+			return prmName + "." + field.Path()
+		}
+	}
+	return ""
+}
+
 func (g *generator) GenerateRowMap(prm looker.Parameter, mapName string, prmName string) error {
 	if prm.Kind() == reflect.Struct.String() {
 		st := prm.(*looker.StructElement)
 		for _, field := range st.Fields {
+			if field.Batch != nil {
+				g.GenerateBatch(field, mapName, prmName)
+				continue
+			}
 			g.p("%s.AppendTo(%q, &%s.%s)", mapName, field.ColumnName(), prmName, field.Path())
 		}
 		g.br()
@@ -272,35 +806,176 @@ func (g *generator) GenerateRowMap(prm looker.Parameter, mapName string, prmName
 	return nil
 }
 
+// GenerateBatch generates the conversion of the slice of structs marked with the option batch of tag
+// to sal.Batch, the batch is expanded to the list of rows by sal.Controller.ProcessQuery.
+func (g *generator) GenerateBatch(field looker.Field, mapName string, prmName string) {
+	batch := batchVar(field)
+	cols := make([]string, 0, len(field.Batch.Fields))
+	for _, f := range field.Batch.Fields {
+		cols = append(cols, f.ColumnName())
+	}
+	g.p("%s := sal.Batch{Cols: %#v, Rows: make([][]interface{}, 0, len(%s.%s))}", batch, cols, prmName, field.Path())
+	g.itemValues(field.Batch, prmName+"."+field.Path(), batch+".Rows", batch+".Cols")
+	g.p("%s.AppendTo(%q, %s)", mapName, field.ColumnName(), batch)
+}
+
+// batchVar returns the name of variable of sal.Batch for the field.
+func batchVar(field looker.Field) string {
+	return "batch" + strings.Replace(field.Path(), ".", "", -1)
+}
+
+// batchField returns the field of request that is marked with the option batch of tag.
+func batchField(prm looker.Parameter) (looker.Field, bool, error) {
+	st, ok := prm.(*looker.StructElement)
+	if !ok {
+		return looker.Field{}, false, nil
+	}
+	var (
+		batch looker.Field
+		found bool
+	)
+	for _, field := range st.Fields {
+		if field.Batch == nil {
+			continue
+		}
+		if found {
+			return looker.Field{}, false, errors.Errorf("request %s has more than one batch field", st.UserType)
+		}
+		batch, found = field, true
+	}
+	return batch, found, nil
+}
+
+// GenerateBatchChunks generates the split of the batch of request to the chunks that are executed
+// by the recursive calls of method, so the number of args of query stays under the limit of database.
+// The chunks are executed in the transaction that is started if the method is called outside of one.
+// The method doesn't query the database if the batch is empty. The batch of QueryRow method
+// isn't split, so the method fails with sal.ErrEmptyBatch if it's empty and with sal.BatchSizeError
+// if it exceeds the limit.
+func (g *generator) GenerateBatchChunks(dstPkg looker.ImportElement, intf *looker.Interface, mtd *looker.Method, field looker.Field, operation sal.OperationType, errResp string) {
+	var (
+		rows    = "req." + field.Path()
+		resp    = mtd.Out[0]
+		res     string
+		resType string
+		empty   string
+	)
+	sizeErr := fmt.Sprintf("&sal.BatchSizeError{Name: %q, Rows: len(%s), Max: size}", field.ColumnName(), rows)
+	batchSize := fmt.Sprintf("s.ctrl.BatchSize(req.Query(), %q, %d)", field.ColumnName(), len(field.Batch.Fields))
+	switch {
+	case operation == sal.OperationTypeQueryRow:
+		g.p("// the batch of single-row query isn't split to chunks.")
+		g.p("if len(%s) == 0 {", rows)
+		g.p("return %s", errList(errResp, "sal.ErrEmptyBatch"))
+		g.p("}")
+		g.p("if size := %s; len(%s) > size {", batchSize, rows)
+		g.p("return %s", errList(errResp, sizeErr))
+		g.p("}")
+		g.br()
+		return
+	case operation == sal.OperationTypeQuery:
+		res, resType, empty = "list", resp.Name(dstPkg.Path), fmt.Sprintf("make(%s, 0)", resp.Name(dstPkg.Path))
+	case isSqlResult(resp):
+		res, resType, empty = "res", "sql.Result", "sal.BatchResult{}"
+	}
+	g.p("// the rows of batch are bound by chunks to keep the number of args under the limit of database.")
+	g.p("if len(%s) == 0 {", rows)
+	g.p("return %s", errList(empty, "nil"))
+	g.p("}")
+	g.p("size := %s", batchSize)
+	g.p("if size == 0 {")
+	g.p("return %s", errList(errResp, sizeErr))
+	g.p("}")
+	g.p("if len(%s) > size {", rows)
+	g.callInTx(intf, mtd.Name+"(ctx, req)", res, resType, errResp)
+	switch res {
+	case "list":
+		g.p("var list = make(%s, 0, len(%s))", resType, rows)
+	case "res":
+		g.p("var res sal.BatchResult")
+	}
+	g.p("for start := 0; start < len(%s); start += size {", rows)
+	g.p("end := start + size")
+	g.p("if end > len(%s) {", rows)
+	g.p("end = len(%s)", rows)
+	g.p("}")
+	chunk := "chunk"
+	if mtd.In[1].Pointer() {
+		g.p("chunk := *req")
+		chunk = "&chunk"
+	} else {
+		g.p("chunk := req")
+	}
+	g.p("chunk.%s = %s[start:end]", field.Path(), rows)
+	if res == "" {
+		g.p("if err := s.%s(ctx, %s); err != nil {", mtd.Name, chunk)
+		g.p("return err")
+		g.p("}")
+	} else {
+		g.p("part, err := s.%s(ctx, %s)", mtd.Name, chunk)
+		g.p("if err != nil {")
+		g.p("return %s", errList(errResp, "err"))
+		g.p("}")
+		if res == "list" {
+			g.p("list = append(list, part...)")
+		} else {
+			g.p("res = append(res, part)")
+		}
+	}
+	g.p("}")
+	g.p("return %s", errList(res, "nil"))
+	g.p("}")
+	g.br()
+}
+
 func (g *generator) GenerateBeginTx(dstPkg looker.ImportElement, intf *looker.Interface) {
 	g.p("func (s *%s) BeginTx(ctx context.Context, opts *sql.TxOptions) (%s, error) {", intf.ImplementationName(Prefix), intf.Name(dstPkg.Path))
-	g.p("dbConn, ok := s.handler.(sal.TransactionBegin)")
-	g.p("if !ok {")
-	g.p("return nil, errors.New(%q)", "handler doesn't satisfy the interface TransactionBegin")
-	g.p("}")
 	g.p("var (")
 	g.p("err error")
-	g.p("tx  *sql.Tx")
+	g.p("tx  sal.SqlTx")
 	g.p(")")
 	g.br()
 
 	g.p("ctx = context.WithValue(ctx, sal.ContextKeyTxOpened, s.txOpened)")
 	g.p("ctx = context.WithValue(ctx, sal.ContextKeyOperationType, %q)", sal.OperationTypeBegin.String())
 	g.p("ctx = context.WithValue(ctx, sal.ContextKeyMethodName, %q)", "BeginTx")
+	g.p("ctx = sal.WithOperation(ctx, &sal.OperationInfo{")
+	g.p("Interface: %q,", intf.UserType)
+	g.p("Method: %q,", "BeginTx")
+	g.p("Type: sal.OperationTypeBegin,")
+	g.p("RawQuery: %q,", "BEGIN")
+	g.p("Query: %q,", "BEGIN")
+	g.p("TxOpened: s.txOpened,")
+	g.p("Tx: s.Tx(),")
+	g.p("})")
 	g.br()
 
 	g.beforeQueryHook(`"BEGIN"`, "nil")
 	g.br()
 
-	g.p("tx, err = dbConn.BeginTx(ctx, opts)")
-	g.p("if err != nil {")
-	g.p("err = errors.Wrap(err, %q)", "failed to start tx")
-	g.p("return nil, err")
+	g.p("op := &sal.Operation{")
+	g.p("Method: %q,", "BeginTx")
+	g.p("Type: sal.OperationTypeBegin,")
+	g.p("Query: %q,", "BEGIN")
+	g.p("Response: &tx,")
+	g.p("Handler: s.handler,")
 	g.p("}")
+	g.p("err = s.ctrl.Invoke(ctx, op, func(ctx context.Context, op *sal.Operation) error {")
+	g.p("var err error")
+	g.p("tx, err = s.ctrl.BeginTx(ctx, s.handler, opts)")
+	g.ifErr("failed to start tx")
+	g.p("return nil")
+	g.p("})")
+	g.ifErrReturn("nil")
 	g.br()
+	g.p("// the nested transaction keeps the parent of transaction to prepare statements.")
+	g.p("parent := s.handler")
+	g.p("if s.txOpened {")
+	g.p("parent = s.parent")
+	g.p("}")
 	g.p("newClient := &%s{", intf.ImplementationName(Prefix))
 	g.p("handler: tx,")
-	g.p("parent: s.handler,")
+	g.p("parent: parent,")
 	g.p("ctrl: s.ctrl,")
 	g.p("txOpened: true,")
 	g.p("}")
@@ -318,12 +993,43 @@ func (g *generator) GenerateTx(dstPkg looker.ImportElement, intf *looker.Interfa
 	g.p("}")
 }
 
-func (g *generator) ifErr(resp, msg string) {
+// GenerateRunInTx generates the method RunInTx that runs fn in the transaction
+// and retries the whole transaction on the retryable errors, see sal.Controller.Retry.
+func (g *generator) GenerateRunInTx(dstPkg looker.ImportElement, intf *looker.Interface) {
+	implName, intfName := intf.ImplementationName(Prefix), intf.Name(dstPkg.Path)
+	g.p("func (s *%s) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(%s) error) error {", implName, intfName)
+	g.p("run := func(ctx context.Context) error {")
+	g.p("client, err := s.BeginTx(ctx, opts)")
 	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("return sal.RunTx(ctx, client.(*%s).Tx(), func() error {", implName)
+	g.p("return fn(client)")
+	g.p("})")
+	g.p("}")
+	g.p("// the nested transaction can't be retried, the error aborts the whole transaction.")
+	g.p("if s.txOpened {")
+	g.p("return run(ctx)")
+	g.p("}")
+	g.p("return s.ctrl.Retry(ctx, run)")
+	g.p("}")
+}
+
+// ifErr generates the return of wrapped error from the invoker of operation.
+func (g *generator) ifErr(msg string) {
+	g.p("if err != nil {")
+	g.p("return errors.Wrap(err, %q)", msg)
+	g.p("}")
+}
+
+// ifErrReturn generates the return of error of operation that is processed by OnError hooks.
+func (g *generator) ifErrReturn(resp string) {
+	g.p("if err != nil {")
+	g.p("err = s.ctrl.HandleError(ctx, err)")
 	if resp == "" {
-		g.p("return errors.Wrap(err, %q)", msg)
+		g.p("return err")
 	} else {
-		g.p("return %s, errors.Wrap(err, %q)", resp, msg)
+		g.p("return %s, err", resp)
 	}
 	g.p("}")
 }
@@ -414,3 +1120,13 @@ func isSqlResult(prm looker.Parameter) bool {
 	}
 	return false
 }
+
+func isNoPreparer(prm looker.Parameter) bool {
+	st, ok := prm.(*looker.StructElement)
+	return ok && st.NoPreparer
+}
+
+func isPrimaryReader(prm looker.Parameter) bool {
+	st, ok := prm.(*looker.StructElement)
+	return ok && st.PrimaryReader
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/go-gad/sal/looker"
@@ -48,6 +49,69 @@ func TestGenerateCode2(t *testing.T) {
 	}
 }
 
+func TestGenerator_Dialect(t *testing.T) {
+	dstPkg := looker.ImportElement{Path: "github.com/go-gad/sal/looker/testdata"}
+	pkg, err := looker.Reflect("github.com/go-gad/sal/looker/testdata", []string{"Store"})
+	if err != nil {
+		t.Fatalf("Failed to reflect package: %+v", err)
+	}
+	g := &generator{dialect: "mysql"}
+	if err := g.Generate(pkg, dstPkg); err != nil {
+		t.Fatalf("Failed to generate a code: %+v", err)
+	}
+	exp := "options = append([]sal.ClientOption{sal.WithDialect(sal.DialectMySQL)}, options...)"
+	if !strings.Contains(string(g.Output()), exp) {
+		t.Errorf("generated code doesn't contain %q", exp)
+	}
+}
+
+func TestGenerator_CursorDialect(t *testing.T) {
+	dstPkg := looker.ImportElement{Path: "github.com/go-gad/sal/examples/bookstore"}
+	pkg, err := looker.Reflect("github.com/go-gad/sal/examples/bookstore", []string{"Store"})
+	if err != nil {
+		t.Fatalf("Failed to reflect package: %+v", err)
+	}
+	g := &generator{dialect: "mysql"}
+	err = g.Generate(pkg, dstPkg)
+	if err == nil || !strings.Contains(err.Error(), "Store.ExportAuthors") {
+		t.Errorf("cursor method should be rejected for mysql, got error %v", err)
+	}
+}
+
+func TestGenerator_CopyTableNamer(t *testing.T) {
+	dstPkg := looker.ImportElement{Path: "github.com/go-gad/sal/looker/testdata"}
+	intf := &looker.Interface{UserType: "Store"}
+	mtd := &looker.Method{
+		Name: "CopyItems",
+		In: looker.Parameters{
+			&looker.InterfaceElement{ImportPath: looker.ImportElement{Path: "context"}, UserType: "Context"},
+			&looker.SliceElement{Item: &looker.StructElement{
+				ImportPath: dstPkg,
+				UserType:   "Item1",
+				IsPointer:  true,
+				Fields:     looker.Fields{{Name: "ID", Tag: "id"}},
+			}},
+		},
+		Out: looker.Parameters{&looker.InterfaceElement{UserType: "error"}},
+	}
+	err := new(generator).GenerateMethod(dstPkg, intf, mtd)
+	if err == nil || !strings.Contains(err.Error(), "item Item1 of copy method doesn't implement sal.TableNamer") {
+		t.Errorf("copy method without TableName should be rejected, got error %v", err)
+	}
+
+	item := mtd.In[1].(*looker.SliceElement).Item.(*looker.StructElement)
+	item.TableNamer = true
+	if err := new(generator).GenerateMethod(dstPkg, intf, mtd); err != nil {
+		t.Errorf("unexpected error %+v", err)
+	}
+
+	item.Fields = nil
+	err = new(generator).GenerateMethod(dstPkg, intf, mtd)
+	if err == nil || !strings.Contains(err.Error(), "item Item1 of copy method has no fields mapped to columns") {
+		t.Errorf("copy method of item without fields should be rejected, got error %v", err)
+	}
+}
+
 func TestGenerator_GenerateRowMap(t *testing.T) {
 	prm := &looker.UnsupportedElement{
 		ImportPath: looker.ImportElement{},
@@ -60,3 +124,20 @@ func TestGenerator_GenerateRowMap(t *testing.T) {
 		t.Error("should be error")
 	}
 }
+
+func TestShardKey(t *testing.T) {
+	req := &looker.StructElement{Fields: looker.Fields{
+		{Name: "Login"},
+		{Name: "TenantID", Parents: []string{"Tenant"}, Shard: true},
+	}}
+	if key := shardKey(req, "req"); key != "req.Tenant.TenantID" {
+		t.Errorf("unexpected key of field %q", key)
+	}
+	req.ShardKeyer = true
+	if key := shardKey(req, "req"); key != "req.ShardKey()" {
+		t.Errorf("unexpected key of ShardKeyer %q", key)
+	}
+	if key := shardKey(&looker.StructElement{}, "req"); key != "" {
+		t.Errorf("unexpected key %q", key)
+	}
+}
@@ -14,6 +14,7 @@ import (
 var (
 	destination = flag.String("destination", "", "Output file; defaults to stdout.")
 	packageName = flag.String("package", "", "The full import path of the library for the generated implementation")
+	dialect     = flag.String("dialect", "postgres", "The dialect of database: postgres, mysql, sqlite, sqlserver or oracle.")
 )
 
 func main() {
@@ -63,7 +64,10 @@ func GenerateCode(dstPkg looker.ImportElement, srcpkg string, symbols []string)
 		return nil, errors.Wrap(err, "failed to reflect package")
 	}
 
-	g := new(generator)
+	if _, ok := dialects[*dialect]; !ok {
+		return nil, errors.Errorf("unknown dialect %q", *dialect)
+	}
+	g := &generator{dialect: *dialect}
 
 	if err := g.Generate(pkg, dstPkg); err != nil {
 		return nil, errors.Wrap(err, "failed generating mock")
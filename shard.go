@@ -0,0 +1,147 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// ShardKeyer is an interface of request that returns the key of shard to execute the query on, see Shards.
+// The key can also be defined by the field of request with the option shard of tag, `sql:"tenant_id,shard"`.
+//
+//	func (r *GetAuthorsReq) ShardKey() interface{} { return r.TenantID }
+type ShardKeyer interface {
+	ShardKey() interface{}
+}
+
+// ErrNoShardKey is returned by Shards if the key of shard isn't defined for the operation.
+var ErrNoShardKey = errors.New("sal: shard key isn't defined")
+
+// ShardFunc returns the index of shard for the key, n is the number of shards.
+type ShardFunc func(key interface{}, n int) (int, error)
+
+// HashShard is the default ShardFunc. It distributes the keys by the FNV-1a hash of their string form.
+func HashShard(key interface{}, n int) (int, error) {
+	h := fnv.New32a()
+	fmt.Fprint(h, key)
+	return int(h.Sum32() % uint32(n)), nil
+}
+
+// Shards is the QueryHandler that executes the query on the shard that is selected by the shard key.
+// The key is taken from the OperationInfo stored in the context by generated methods,
+// see ShardKeyer. If the operation has no key, e.g. BeginTx, then the key set by WithShardKey is used.
+//
+//	client := NewStore(sal.NewShards([]sal.QueryHandler{db1, db2, db3}))
+//	tx, err := client.BeginTx(sal.WithShardKey(ctx, tenantID), nil)
+//
+// The Controller keeps the cache of prepared statements for each shard.
+// All operations of transaction must have the key of the shard the transaction is started on.
+type Shards struct {
+	handlers []QueryHandler
+	shardFn  ShardFunc
+}
+
+// ShardsOption sets the optional parameters of Shards.
+type ShardsOption func(s *Shards)
+
+// ShardBy sets the function that maps the keys to shards. By default HashShard is used.
+func ShardBy(fn ShardFunc) ShardsOption {
+	return func(s *Shards) { s.shardFn = fn }
+}
+
+// NewShards returns the handler of shards.
+func NewShards(handlers []QueryHandler, opts ...ShardsOption) *Shards {
+	s := &Shards{handlers: handlers, shardFn: HashShard}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type shardKeyCtx struct{}
+
+// WithShardKey returns the copy of ctx with the key of shard for the operations without their own key.
+func WithShardKey(ctx context.Context, key interface{}) context.Context {
+	return context.WithValue(ctx, shardKeyCtx{}, key)
+}
+
+// Shard returns the handler of shard to execute the operation in ctx.
+func (s *Shards) Shard(ctx context.Context) (QueryHandler, error) {
+	var key interface{}
+	if info, ok := OperationFromContext(ctx); ok {
+		key = info.ShardKey
+	}
+	if key == nil {
+		key = ctx.Value(shardKeyCtx{})
+	}
+	if key == nil {
+		return nil, ErrNoShardKey
+	}
+	if len(s.handlers) == 0 {
+		return nil, errors.New("sal: there are no shards")
+	}
+	i, err := s.shardFn(key, len(s.handlers))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get shard by key %v", key)
+	}
+	if i < 0 || i >= len(s.handlers) {
+		return nil, errors.Errorf("shard %d for key %v is out of range", i, key)
+	}
+	return s.handlers[i], nil
+}
+
+// QueryContext executes the query on the shard of operation in ctx.
+func (s *Shards) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	qh, err := s.Shard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return qh.QueryContext(ctx, query, args...)
+}
+
+// ExecContext executes the query on the shard of operation in ctx.
+func (s *Shards) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	qh, err := s.Shard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return qh.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext prepares the statement on the shard of operation in ctx.
+func (s *Shards) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	qh, err := s.Shard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return qh.PrepareContext(ctx, query)
+}
+
+// BeginTx starts the transaction on the shard of operation in ctx.
+func (s *Shards) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	qh, err := s.Shard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txb, ok := qh.(TransactionBegin)
+	if !ok {
+		return nil, errors.Errorf("failed to start tx: shard %T doesn't implement BeginTx", qh)
+	}
+	return txb.BeginTx(ctx, opts)
+}
+
+// shardStmt returns the statement to execute the query on qh, that is the shard or the transaction
+// started on the shard. The prepared statements are kept in the cache of shard.
+func (ctrl *Controller) shardStmt(ctx context.Context, shard QueryHandler, parent QueryHandler, qh QueryHandler, query string) (Stmt, error) {
+	if ctrl.SkipPrepare {
+		return DirectStmt(qh, query), nil
+	}
+	stmt, release, err := ctrl.acquireStmt(ctx, ctrl.handlerCache(shard), parent, qh, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmtOf(stmt, release), nil
+}
@@ -0,0 +1,48 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShards_Shard(t *testing.T) {
+	dbs := []QueryHandler{&sql.DB{}, &sql.DB{}, &sql.DB{}}
+	s := NewShards(dbs, ShardBy(func(key interface{}, n int) (int, error) {
+		return int(key.(int64)), nil
+	}))
+
+	_, err := s.Shard(context.Background())
+	assert.Equal(t, ErrNoShardKey, err)
+
+	ctx := WithShardKey(context.Background(), int64(1))
+	qh, err := s.Shard(ctx)
+	assert.Nil(t, err)
+	assert.True(t, dbs[1] == qh)
+
+	// the key of operation takes precedence over the key of context.
+	qh, err = s.Shard(WithOperation(ctx, &OperationInfo{ShardKey: int64(2)}))
+	assert.Nil(t, err)
+	assert.True(t, dbs[2] == qh)
+	qh, err = s.Shard(WithOperation(ctx, &OperationInfo{}))
+	assert.Nil(t, err)
+	assert.True(t, dbs[1] == qh)
+
+	_, err = s.Shard(WithShardKey(context.Background(), int64(3)))
+	assert.EqualError(t, err, "shard 3 for key 3 is out of range")
+}
+
+func TestHashShard(t *testing.T) {
+	seen := make(map[int]bool)
+	for key := 0; key < 100; key++ {
+		i, err := HashShard(key, 4)
+		assert.Nil(t, err)
+		assert.True(t, i >= 0 && i < 4)
+		j, _ := HashShard(key, 4)
+		assert.Equal(t, i, j)
+		seen[i] = true
+	}
+	assert.Len(t, seen, 4)
+}
@@ -0,0 +1,330 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy describes how the failed transaction is retried by RunInTx of generated clients.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// Zero or one disables the retries.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt. It's doubled for each next attempt.
+	Backoff time.Duration
+	// MaxBackoff limits the delay between attempts. Zero means no limit.
+	MaxBackoff time.Duration
+	// Retryable reports whether the transaction failed with err can be retried.
+	// If it's nil then IsRetryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is the retry policy of Controller by default.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     10 * time.Millisecond,
+	MaxBackoff:  time.Second,
+}
+
+// WithRetryPolicy sets the policy of retries of transactions started by RunInTx.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(ctrl *Controller) { ctrl.RetryPolicy = policy }
+}
+
+// SQLSTATE codes of errors that are resolved by the retry of transaction.
+const (
+	SQLStateSerializationFailure = "40001"
+	SQLStateDeadlockDetected     = "40P01"
+)
+
+// IsRetryable reports whether err is the serialization failure or the deadlock,
+// so the transaction can be retried.
+func IsRetryable(err error) bool {
+	switch SQLState(err) {
+	case SQLStateSerializationFailure, SQLStateDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+// SQLState returns the SQLSTATE code of the database error or empty string if err doesn't contain it.
+// The errors with method SQLState() string, as in pgx, and the errors with string field Code,
+// as in lib/pq, are supported. The wrapped errors are unwrapped with errors.Cause.
+func SQLState(err error) string {
+	if err == nil {
+		return ""
+	}
+	err = errors.Cause(err)
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return e.SQLState()
+	}
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if code := v.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+		return code.String()
+	}
+	return ""
+}
+
+// Retry calls fn until it succeeds, fails with the error that isn't retryable, or the attempts
+// of RetryPolicy are exhausted. The delay between attempts grows exponentially.
+// The last error is returned, also if ctx is done while waiting for the next attempt.
+func (ctrl *Controller) Retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	var (
+		policy    = ctrl.RetryPolicy
+		retryable = policy.Retryable
+		backoff   = policy.Backoff
+	)
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// RunTx calls fn and commits tx if it succeeds. If fn fails or panics then tx is rolled back.
+// The error of fn is returned even if the rollback fails, the panic is repeated after the rollback.
+func RunTx(ctx context.Context, tx Transaction, fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+	if err = fn(); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// BeginTx starts the transaction with qh that should implement TransactionBegin, e.g. *sql.DB.
+// If qh is the transaction already then the nested transaction is started with Savepoint,
+// opts are ignored in this case.
+func (ctrl *Controller) BeginTx(ctx context.Context, qh QueryHandler, opts *sql.TxOptions) (SqlTx, error) {
+	var (
+		tx  SqlTx
+		err error
+	)
+	switch h := qh.(type) {
+	case SqlTx:
+		tx, err = BeginSavepoint(ctx, h, ctrl.dialect())
+	case TransactionBegin:
+		tx, err = h.BeginTx(ctx, opts)
+	default:
+		return nil, errors.Errorf("handler %T doesn't satisfy the interface TransactionBegin", qh)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctrl.trackTx(ctx, tx)
+	return tx, nil
+}
+
+// finishTx releases the resources of transaction that is committed or rolled back
+// and calls the callbacks of transaction. The transaction should be untracked before
+// it's finished, see untrackTx.
+func (ctrl *Controller) finishTx(ctx context.Context, tx interface{}, committed bool) {
+	ctrl.CloseTxStmts(tx)
+	ctrl.runTxCallbacks(ctx, tx, committed)
+}
+
+// savepointSeq is used to give the unique names to savepoints.
+var savepointSeq uint64
+
+// Savepoint is the nested transaction that is implemented with the savepoint of transaction.
+// It implements SqlTx, so it's used by the client of nested transaction as the regular transaction,
+// but Commit releases the savepoint and Rollback rolls back to the savepoint. The transaction stays opened.
+//
+// The savepoints are created with the syntax of dialect, SAVE TRANSACTION is used for SQL Server.
+// SQL Server and Oracle don't release savepoints, so Commit doesn't query the database for them.
+type Savepoint struct {
+	SqlTx
+	name    string
+	dialect Dialect
+	done    int32
+}
+
+// BeginSavepoint creates the savepoint in the transaction tx with the syntax of dialect d.
+// DialectPostgreSQL is used if d is nil.
+func BeginSavepoint(ctx context.Context, tx SqlTx, d Dialect) (*Savepoint, error) {
+	if d == nil {
+		d = DialectPostgreSQL
+	}
+	sp := &Savepoint{
+		SqlTx:   tx,
+		name:    "sal_sp_" + strconv.FormatUint(atomic.AddUint64(&savepointSeq, 1), 10),
+		dialect: d,
+	}
+	begin, _, _ := savepointQueries(d)
+	if _, err := tx.ExecContext(ctx, begin+sp.name); err != nil {
+		return nil, errors.Wrap(err, "failed to create savepoint")
+	}
+	return sp, nil
+}
+
+// Name returns the name of savepoint.
+func (sp *Savepoint) Name() string {
+	return sp.name
+}
+
+// Commit releases the savepoint.
+func (sp *Savepoint) Commit() error {
+	return sp.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but executes the statement with ctx, it's used by WrappedTx.Commit.
+func (sp *Savepoint) CommitContext(ctx context.Context) error {
+	_, release, _ := savepointQueries(sp.dialect)
+	return sp.finish(ctx, release)
+}
+
+// Rollback rolls back the transaction to the savepoint.
+func (sp *Savepoint) Rollback() error {
+	return sp.RollbackContext(context.Background())
+}
+
+// RollbackContext is like Rollback but executes the statement with ctx, it's used by WrappedTx.Rollback.
+func (sp *Savepoint) RollbackContext(ctx context.Context) error {
+	_, _, rollback := savepointQueries(sp.dialect)
+	return sp.finish(ctx, rollback)
+}
+
+func (sp *Savepoint) finish(ctx context.Context, stmt string) error {
+	if !atomic.CompareAndSwapInt32(&sp.done, 0, 1) {
+		return sql.ErrTxDone
+	}
+	if stmt == "" {
+		return nil
+	}
+	_, err := sp.SqlTx.ExecContext(ctx, stmt+sp.name)
+	return err
+}
+
+// savepointQueries returns the beginnings of statements that create, release and roll back to
+// the savepoint in dialect d. The release is empty if the savepoints aren't released in dialect.
+func savepointQueries(d Dialect) (begin, release, rollback string) {
+	switch d.Name() {
+	case DialectSQLServer.Name():
+		return "SAVE TRANSACTION ", "", "ROLLBACK TRANSACTION "
+	case DialectOracle.Name():
+		return "SAVEPOINT ", "", "ROLLBACK TO SAVEPOINT "
+	}
+	return "SAVEPOINT ", "RELEASE SAVEPOINT ", "ROLLBACK TO SAVEPOINT "
+}
+
+// TxCallback is called after the outcome of transaction is known.
+type TxCallback func(ctx context.Context)
+
+type txCallbacks struct {
+	commit   []TxCallback
+	rollback []TxCallback
+}
+
+// AfterCommit registers fn to be called once after the successful commit of transaction.
+// The callback registered in the nested transaction is called after the commit of the outer one.
+func (wtx *WrappedTx) AfterCommit(fn TxCallback) {
+	wtx.ctrl.addTxCallback(wtx.Tx, fn, nil)
+}
+
+// AfterRollback registers fn to be called once after the rollback of transaction,
+// also if the commit fails.
+func (wtx *WrappedTx) AfterRollback(fn TxCallback) {
+	wtx.ctrl.addTxCallback(wtx.Tx, nil, fn)
+}
+
+// TxFromContext returns the transaction the operation is executed in.
+// It's available inside generated methods and methods of WrappedTx,
+// e.g. in BeforeQuery hooks and interceptors:
+//
+//	if tx, ok := sal.TxFromContext(ctx); ok {
+//		tx.AfterCommit(func(ctx context.Context) { cache.Invalidate(key) })
+//	}
+func TxFromContext(ctx context.Context) (Transaction, bool) {
+	info, ok := OperationFromContext(ctx)
+	if !ok || info.Tx == nil {
+		return nil, false
+	}
+	return info.Tx, true
+}
+
+func (ctrl *Controller) addTxCallback(tx interface{}, commit, rollback TxCallback) {
+	if !reflect.TypeOf(tx).Comparable() {
+		return
+	}
+	ctrl.Lock()
+	defer ctrl.Unlock()
+	if ctrl.txCallbacks == nil {
+		ctrl.txCallbacks = make(map[interface{}]*txCallbacks)
+	}
+	cb, ok := ctrl.txCallbacks[tx]
+	if !ok {
+		cb = new(txCallbacks)
+		ctrl.txCallbacks[tx] = cb
+	}
+	if commit != nil {
+		cb.commit = append(cb.commit, commit)
+	}
+	if rollback != nil {
+		cb.rollback = append(cb.rollback, rollback)
+	}
+}
+
+// runTxCallbacks calls the callbacks of finished transaction. The callbacks of released savepoint
+// are passed to the outer transaction, because its outcome isn't known yet.
+func (ctrl *Controller) runTxCallbacks(ctx context.Context, tx interface{}, committed bool) {
+	if !reflect.TypeOf(tx).Comparable() {
+		return
+	}
+	ctrl.Lock()
+	cb, ok := ctrl.txCallbacks[tx]
+	delete(ctrl.txCallbacks, tx)
+	if sp, isSavepoint := tx.(*Savepoint); ok && isSavepoint && committed {
+		parent := ctrl.txCallbacks[sp.SqlTx]
+		if parent == nil {
+			parent = new(txCallbacks)
+			ctrl.txCallbacks[sp.SqlTx] = parent
+		}
+		parent.commit = append(parent.commit, cb.commit...)
+		parent.rollback = append(parent.rollback, cb.rollback...)
+		ok = false
+	}
+	ctrl.Unlock()
+	if !ok {
+		return
+	}
+
+	fns := cb.rollback
+	if committed {
+		fns = cb.commit
+	}
+	for _, fn := range fns {
+		fn(ctx)
+	}
+}
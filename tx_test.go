@@ -0,0 +1,281 @@
+package sal
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestSQLState(t *testing.T) {
+	assert.Equal(t, "", SQLState(nil))
+	assert.Equal(t, "", SQLState(errors.New("foo")))
+	assert.Equal(t, "40001", SQLState(&pq.Error{Code: "40001"}))
+	assert.Equal(t, "40P01", SQLState(errors.Wrap(&pq.Error{Code: "40P01"}, "failed")))
+	assert.Equal(t, "23505", SQLState(errors.WithStack(sqlStateError("23505"))))
+
+	assert.True(t, IsRetryable(&pq.Error{Code: "40001"}))
+	assert.True(t, IsRetryable(sqlStateError("40P01")))
+	assert.False(t, IsRetryable(&pq.Error{Code: "23505"}))
+}
+
+func TestController_Retry(t *testing.T) {
+	ctx := context.Background()
+	errRetryable := &pq.Error{Code: SQLStateSerializationFailure}
+	ctrl := NewController(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+
+	var attempts int
+	err := ctrl.Retry(ctx, func(ctx context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return errRetryable
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	err = ctrl.Retry(ctx, func(ctx context.Context) error {
+		attempts++
+		return errRetryable
+	})
+	assert.Equal(t, errRetryable, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	errOther := errors.New("unique violation")
+	err = ctrl.Retry(ctx, func(ctx context.Context) error {
+		attempts++
+		return errOther
+	})
+	assert.Equal(t, errOther, err)
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = NewController(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour})).Retry(canceled, func(ctx context.Context) error {
+		attempts++
+		return errRetryable
+	})
+	assert.Equal(t, errRetryable, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRunTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	begin := func() Transaction {
+		sqlTx, err := db.Begin()
+		assert.NoError(t, err)
+		return NewWrappedTx(sqlTx, nil)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(t, RunTx(ctx, begin(), func() error { return nil }))
+
+	errFn := errors.New("failed")
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	assert.Equal(t, errFn, RunTx(ctx, begin(), func() error { return errFn }))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	assert.Panics(t, func() {
+		RunTx(ctx, begin(), func() error { panic("oops") })
+	})
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestController_BeginTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	ctrl := NewController()
+
+	mock.ExpectBegin()
+	tx, err := ctrl.BeginTx(ctx, db, nil)
+	assert.NoError(t, err)
+
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	sp, err := ctrl.BeginTx(ctx, tx, nil)
+	assert.NoError(t, err)
+	if assert.IsType(t, &Savepoint{}, sp) {
+		name := sp.(*Savepoint).Name()
+		mock.ExpectExec("RELEASE SAVEPOINT " + name).WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.NoError(t, sp.Commit())
+		assert.Equal(t, sql.ErrTxDone, sp.Rollback())
+	}
+
+	mock.ExpectRollback()
+	assert.NoError(t, tx.Rollback())
+
+	// the handler doesn't start transactions.
+	_, err = ctrl.BeginTx(ctx, struct{ QueryHandler }{db}, nil)
+	assert.Error(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSavepoint_Dialects(t *testing.T) {
+	for _, tc := range []struct {
+		dialect  Dialect
+		begin    string
+		release  string
+		rollback string
+	}{
+		{
+			dialect:  DialectPostgreSQL,
+			begin:    "SAVEPOINT ",
+			release:  "RELEASE SAVEPOINT ",
+			rollback: "ROLLBACK TO SAVEPOINT ",
+		}, {
+			dialect:  DialectMySQL,
+			begin:    "SAVEPOINT ",
+			release:  "RELEASE SAVEPOINT ",
+			rollback: "ROLLBACK TO SAVEPOINT ",
+		}, {
+			dialect:  DialectSQLServer,
+			begin:    "SAVE TRANSACTION ",
+			rollback: "ROLLBACK TRANSACTION ",
+		}, {
+			dialect:  DialectOracle,
+			begin:    "SAVEPOINT ",
+			rollback: "ROLLBACK TO SAVEPOINT ",
+		},
+	} {
+		t.Run(tc.dialect.Name(), func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+			ctx := context.Background()
+			ctrl := NewController(WithDialect(tc.dialect))
+
+			mock.ExpectBegin()
+			tx, err := ctrl.BeginTx(ctx, db, nil)
+			assert.NoError(t, err)
+
+			for _, commit := range []bool{true, false} {
+				mock.ExpectExec("^" + tc.begin + "sal_sp_[0-9]+$").WillReturnResult(sqlmock.NewResult(0, 0))
+				sp, err := ctrl.BeginTx(ctx, tx, nil)
+				if !assert.NoError(t, err) {
+					return
+				}
+				name := sp.(*Savepoint).Name()
+				if commit {
+					if tc.release != "" {
+						mock.ExpectExec("^" + tc.release + name + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+					}
+					assert.NoError(t, NewWrappedTx(sp, ctrl).Commit(ctx))
+				} else {
+					mock.ExpectExec("^" + tc.rollback + name + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+					assert.NoError(t, NewWrappedTx(sp, ctrl).Rollback(ctx))
+				}
+			}
+
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSavepoint_Context(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctrl := NewController()
+
+	mock.ExpectBegin()
+	tx, err := ctrl.BeginTx(context.Background(), db, nil)
+	assert.NoError(t, err)
+	mock.ExpectExec("SAVEPOINT sal_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	sp, err := ctrl.BeginTx(context.Background(), tx, nil)
+	assert.NoError(t, err)
+
+	// the context of WrappedTx is used to release the savepoint.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(NewWrappedTx(sp, ctrl).Commit(ctx)))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestController_BeginTxCanceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctrl := NewController()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mock.ExpectBegin()
+	tx, err := ctrl.BeginTx(ctx, db, nil)
+	assert.NoError(t, err)
+	mock.ExpectPrepare("SELECT 1")
+	_, err = ctrl.PrepareStmt(ctx, nil, tx, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ctrl.OpenTxs())
+
+	rolledBack := make(chan struct{})
+	NewWrappedTx(tx, ctrl).AfterRollback(func(ctx context.Context) { close(rolledBack) })
+	// database/sql rolls back the transaction when the context is done,
+	// the controller releases the statements and calls the callbacks.
+	mock.ExpectRollback()
+	cancel()
+
+	select {
+	case <-rolledBack:
+	case <-time.After(time.Second):
+		t.Fatal("transaction isn't released")
+	}
+	assert.Len(t, ctrl.txStmts, 0)
+	assert.Len(t, ctrl.txCallbacks, 0)
+	assert.Equal(t, 0, ctrl.OpenTxs())
+
+	// the transaction finished with WrappedTx isn't released twice,
+	// another connection is used because the rollback by database/sql is asynchronous.
+	db2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db2.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	mock2.ExpectBegin()
+	tx, err = ctrl.BeginTx(ctx, db2, nil)
+	assert.NoError(t, err)
+	committed := make(chan struct{})
+	NewWrappedTx(tx, ctrl).AfterCommit(func(ctx context.Context) { close(committed) })
+	NewWrappedTx(tx, ctrl).AfterRollback(func(ctx context.Context) { t.Error("committed transaction is rolled back") })
+	mock2.ExpectCommit()
+	assert.NoError(t, NewWrappedTx(tx, ctrl).Commit(context.Background()))
+	<-committed
+	cancel()
+	assert.Equal(t, 0, ctrl.OpenTxs())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}